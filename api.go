@@ -0,0 +1,667 @@
+package webcli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// apiCommand is the JSON representation of a command.
+type apiCommand struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Fields      []apiField `json:"fields"`
+	Args        []apiArg   `json:"args"`
+}
+
+// apiArg is the JSON representation of a positional argument.
+type apiArg struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Required    bool     `json:"required"`
+	Variadic    bool     `json:"variadic"`
+	Options     []string `json:"options,omitempty"`
+}
+
+// apiField is the JSON representation of a field.
+type apiField struct {
+	Name        string   `json:"name"`
+	Type        string   `json:"type"`
+	Array       bool     `json:"array"`
+	Default     string   `json:"default"`
+	Description string   `json:"description"`
+	Options     []string `json:"options,omitempty"`
+	Extensions  []string `json:"extensions,omitempty"`
+	Secret      bool     `json:"secret,omitempty"`
+}
+
+// apiRun is the JSON representation of a run.
+type apiRun struct {
+	*Run
+	Status string `json:"status"`
+}
+
+// apiRunRequest is the request body to launch a run.
+type apiRunRequest struct {
+	Command string         `json:"command"`
+	Params  map[string]any `json:"params"`
+}
+
+// apiHandler returns the handler of the JSON API, served under /api/v1.
+func apiHandler(o *options, cmds []*parsedCommand, runner *runner) http.Handler {
+	cmdLookup := map[string]*parsedCommand{}
+	for _, cmd := range cmds {
+		cmdLookup[cmd.Name] = cmd
+	}
+
+	mux := http.NewServeMux()
+
+	// Launch a command with the given parameters
+	launch := func(w http.ResponseWriter, r *http.Request, name string, params map[string]any) {
+		cmd, ok := cmdLookup[name]
+		if !ok {
+			apiError(w, "command not found", http.StatusNotFound)
+			return
+		}
+		if !o.allowed(r, name, ActionRun) {
+			apiError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		values, err := parseParams(cmd, params)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		flags, effective, flagErr := cmd.flagArgs(valueStrings(values), func(field string) string {
+			return o.secret(cmd.Name, field)
+		}, o.launchMode == LaunchChangedFlags)
+		positional, argErr := parseArgParams(cmd, params)
+		if flagErr != nil || argErr != nil {
+			errs := fieldErrors{}
+			for _, err := range []error{flagErr, argErr} {
+				fe, ok := err.(fieldErrors)
+				if !ok && err != nil {
+					apiError(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+				for k, v := range fe {
+					errs[k] = v
+				}
+			}
+			writeJSON(w, http.StatusBadRequest, map[string]any{
+				"error":  errs.Error(),
+				"fields": errs,
+			})
+			return
+		}
+		args := append([]string{cmd.Name}, flags...)
+		args = append(args, positional...)
+		effective = append([]string{cmd.Name}, effective...)
+		effective = append(effective, positional...)
+		id, proc, err := runner.start(args, effective)
+		if err != nil {
+			apiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		o.audit(r, &AuditEvent{
+			Action:  ActionRun,
+			Command: cmd.Name,
+			Args:    proc.Run().Args,
+			RunID:   id,
+		})
+		writeJSON(w, http.StatusCreated, toAPIRun(proc.Run()))
+	}
+
+	// OpenAPI document, only with the commands the user can see
+	mux.HandleFunc("GET /api/v1/openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		var visible []*parsedCommand
+		for _, cmd := range cmds {
+			if o.allowed(r, cmd.Name, ActionView) {
+				visible = append(visible, cmd)
+			}
+		}
+		writeJSON(w, http.StatusOK, openAPISpec(o, visible))
+	})
+
+	// List commands
+	mux.HandleFunc("GET /api/v1/commands", func(w http.ResponseWriter, r *http.Request) {
+		list := []apiCommand{}
+		for _, cmd := range cmds {
+			if !o.allowed(r, cmd.Name, ActionView) {
+				continue
+			}
+			list = append(list, toAPICommand(cmd))
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+
+	// Get a command
+	mux.HandleFunc("GET /api/v1/commands/{name...}", func(w http.ResponseWriter, r *http.Request) {
+		cmd, ok := cmdLookup[r.PathValue("name")]
+		if !ok {
+			apiError(w, "command not found", http.StatusNotFound)
+			return
+		}
+		if !o.allowed(r, cmd.Name, ActionView) {
+			apiError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		writeJSON(w, http.StatusOK, toAPICommand(cmd))
+	})
+
+	// Launch a command, with its parameters as the body
+	mux.HandleFunc("POST /api/v1/commands/{name...}", func(w http.ResponseWriter, r *http.Request) {
+		params := map[string]any{}
+		if err := decodeJSON(r.Body, &params); err != nil && !errors.Is(err, io.EOF) {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		launch(w, r, r.PathValue("name"), params)
+	})
+
+	// List runs
+	mux.HandleFunc("GET /api/v1/runs", func(w http.ResponseWriter, r *http.Request) {
+		runs, err := runner.list()
+		if err != nil {
+			apiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		list := []apiRun{}
+		for _, run := range runs {
+			if !o.allowed(r, run.Command, ActionView) {
+				continue
+			}
+			list = append(list, toAPIRun(run))
+		}
+		writeJSON(w, http.StatusOK, list)
+	})
+
+	// Launch a run
+	mux.HandleFunc("POST /api/v1/runs", func(w http.ResponseWriter, r *http.Request) {
+		var req apiRunRequest
+		if err := decodeJSON(r.Body, &req); err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		launch(w, r, req.Command, req.Params)
+	})
+
+	// Get a run
+	mux.HandleFunc("GET /api/v1/runs/{id}", func(w http.ResponseWriter, r *http.Request) {
+		run, err := runner.get(r.PathValue("id"))
+		if errors.Is(err, ErrRunNotFound) {
+			apiError(w, "run not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			apiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !o.allowed(r, run.Command, ActionView) {
+			apiError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		writeJSON(w, http.StatusOK, toAPIRun(run))
+	})
+
+	// Cancel a run, killing it right away if force is set
+	mux.HandleFunc("POST /api/v1/runs/{id}/cancel", func(w http.ResponseWriter, r *http.Request) {
+		proc, ok := runner.process(r.PathValue("id"))
+		if !ok || !proc.Run().End.IsZero() {
+			apiError(w, "run is not in progress", http.StatusConflict)
+			return
+		}
+		if !o.allowed(r, proc.Run().Command, ActionCancel) {
+			apiError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if force, _ := strconv.ParseBool(r.URL.Query().Get("force")); force {
+			proc.Kill()
+		} else {
+			proc.Stop()
+		}
+		o.audit(r, &AuditEvent{
+			Action:  ActionCancel,
+			Command: proc.Run().Command,
+			RunID:   r.PathValue("id"),
+		})
+		writeJSON(w, http.StatusAccepted, toAPIRun(proc.Run()))
+	})
+
+	// Send a line to the standard input of a run
+	mux.HandleFunc("POST /api/v1/runs/{id}/input", func(w http.ResponseWriter, r *http.Request) {
+		proc, ok := runner.process(r.PathValue("id"))
+		if !ok || !proc.Run().End.IsZero() {
+			apiError(w, "run is not in progress", http.StatusConflict)
+			return
+		}
+		if !o.allowed(r, proc.Run().Command, ActionRun) {
+			apiError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		var input struct {
+			Line string `json:"line"`
+			EOF  bool   `json:"eof"`
+		}
+		if err := decodeJSON(r.Body, &input); err != nil {
+			apiError(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := proc.Input(input.Line, input.EOF); err != nil {
+			apiError(w, err.Error(), http.StatusConflict)
+			return
+		}
+		writeJSON(w, http.StatusOK, toAPIRun(proc.Run()))
+	})
+
+	// Get the output of a run
+	// With follow=true, the output is streamed until the run ends, and with
+	// stream=stdout or stream=stderr only the output of that stream is sent.
+	mux.HandleFunc("GET /api/v1/runs/{id}/logs", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		run, err := runner.get(id)
+		if errors.Is(err, ErrRunNotFound) {
+			apiError(w, "run not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			apiError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !o.allowed(r, run.Command, ActionView) {
+			apiError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		stream := r.URL.Query().Get("stream")
+		if !validStream(stream) {
+			apiError(w, "invalid stream, must be stdout or stderr", http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+		follow, _ := strconv.ParseBool(r.URL.Query().Get("follow"))
+		proc, live := runner.process(id)
+		if !follow || !live {
+			if _, err := copyOutput(w, o.runStore, id, 0, stream, true); err != nil {
+				log.Println("webcli:", err)
+			}
+			return
+		}
+
+		// Wake up each time the process writes output or ends
+		wake := make(chan struct{}, 1)
+		subID := fmt.Sprintf("%d", time.Now().UnixNano())
+		proc.Subscribe(subID, func(string, bool) {
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		})
+		defer proc.Unsubscribe(subID)
+
+		var pos int64
+		for {
+			// Check if the process has ended before reading, so the final
+			// output isn't missed
+			ended := !proc.Run().End.IsZero()
+			n, err := copyOutput(w, o.runStore, id, pos, stream, ended)
+			if err != nil {
+				log.Println("webcli:", err)
+				return
+			}
+			pos += n
+			w.(http.Flusher).Flush()
+			if ended {
+				return
+			}
+			select {
+			case <-wake:
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+
+	// Read and write saved configs
+	if !o.disableConfig {
+		mux.HandleFunc("GET /api/v1/configs/{name...}", func(w http.ResponseWriter, r *http.Request) {
+			name := r.PathValue("name")
+			cmd, ok := cmdLookup[name]
+			if !ok {
+				apiError(w, "command not found", http.StatusNotFound)
+				return
+			}
+			if !o.allowed(r, name, ActionView) {
+				apiError(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			values, err := o.readConfig(o.configPath(name))
+			if errors.Is(err, os.ErrNotExist) {
+				values = map[string]any{}
+			} else if err != nil {
+				apiError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// Secret values may have been saved by older versions
+			for _, f := range cmd.Fields {
+				if f.Secret {
+					delete(values, f.Name)
+				}
+			}
+			writeJSON(w, http.StatusOK, values)
+		})
+		mux.HandleFunc("PUT /api/v1/configs/{name...}", func(w http.ResponseWriter, r *http.Request) {
+			name := r.PathValue("name")
+			cmd, ok := cmdLookup[name]
+			if !ok {
+				apiError(w, "command not found", http.StatusNotFound)
+				return
+			}
+			if !o.allowed(r, name, ActionSave) {
+				apiError(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			var params map[string]any
+			if err := decodeJSON(r.Body, &params); err != nil {
+				apiError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			values, err := parseParams(cmd, params)
+			if err != nil {
+				apiError(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			config := map[string]any{}
+			for _, v := range values {
+				config[v.field.Name] = v.value
+			}
+			if err := o.saveConfig(r, cmd, config); err != nil {
+				apiError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			writeJSON(w, http.StatusOK, config)
+		})
+	}
+
+	// Unknown endpoints
+	mux.HandleFunc("/api/v1/", func(w http.ResponseWriter, r *http.Request) {
+		apiError(w, "not found", http.StatusNotFound)
+	})
+
+	return mux
+}
+
+func toAPICommand(cmd *parsedCommand) apiCommand {
+	c := apiCommand{
+		Name:        cmd.Name,
+		Description: cmd.Description,
+		Fields:      []apiField{},
+		Args:        []apiArg{},
+	}
+	for _, a := range cmd.Args {
+		c.Args = append(c.Args, apiArg{
+			Name:        a.Name,
+			Description: a.Description,
+			Required:    a.Required,
+			Variadic:    a.Variadic,
+			Options:     a.Options,
+		})
+	}
+	for _, f := range cmd.Fields {
+		c.Fields = append(c.Fields, apiField{
+			Name:        f.Name,
+			Type:        f.Type.String(),
+			Array:       f.Array,
+			Default:     f.Default,
+			Description: f.Description,
+			Options:     f.Options,
+			Extensions:  f.Extensions,
+			Secret:      f.Secret,
+		})
+		if f.Secret {
+			c.Fields[len(c.Fields)-1].Default = ""
+		}
+	}
+	return c
+}
+
+func toAPIRun(run *Run) apiRun {
+	status := "completed"
+	switch {
+	case run.Interrupted:
+		status = "interrupted"
+	case run.Canceled:
+		status = "canceled"
+	case run.Stopping:
+		status = "stopping"
+	case run.End.IsZero():
+		status = "running"
+	case run.Error:
+		status = "failed"
+	}
+	return apiRun{Run: run, Status: status}
+}
+
+// paramValue is a parameter value converted to the type of its field.
+type paramValue struct {
+	field *Field
+	value any
+}
+
+// parseParams converts the JSON parameters to the types of the command
+// fields.
+// Values are returned sorted by name.
+func parseParams(cmd *parsedCommand, params map[string]any) ([]paramValue, error) {
+	lookup := map[string]*Field{}
+	for _, f := range cmd.Fields {
+		lookup[f.Name] = f
+	}
+	args := map[string]bool{}
+	for _, a := range cmd.Args {
+		args[a.Name] = true
+	}
+	var names []string
+	for name := range params {
+		if _, ok := lookup[name]; !ok {
+			// Positional arguments are parsed by parseArgParams
+			if args[name] {
+				continue
+			}
+			return nil, fmt.Errorf("unknown parameter %q", name)
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var values []paramValue
+	for _, name := range names {
+		f := lookup[name]
+		v := params[name]
+		// Uploads are only staged from the web interface, a value would be
+		// passed as a path of the server
+		if f.Type == Upload {
+			return nil, fmt.Errorf("parameter %q is an upload, which isn't supported by the API", name)
+		}
+		if f.Type == Map {
+			value, err := parseMap(f, v)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, paramValue{field: f, value: value})
+			continue
+		}
+		if !f.Array {
+			value, err := parseValue(f, v)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, paramValue{field: f, value: value})
+			continue
+		}
+		items, ok := v.([]any)
+		if !ok {
+			return nil, fmt.Errorf("parameter %q must be an array", name)
+		}
+		list := []any{}
+		for _, item := range items {
+			value, err := parseValue(f, item)
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, value)
+		}
+		values = append(values, paramValue{field: f, value: list})
+	}
+	return values, nil
+}
+
+// parseArgParams returns the positional arguments of the parameters, which are
+// strings or arrays of strings for variadic arguments.
+// Flags take precedence over arguments with the same name.
+func parseArgParams(cmd *parsedCommand, params map[string]any) ([]string, error) {
+	fields := map[string]bool{}
+	for _, f := range cmd.Fields {
+		fields[f.Name] = true
+	}
+	values := map[string][]string{}
+	for _, a := range cmd.Args {
+		v, ok := params[a.Name]
+		if !ok || fields[a.Name] {
+			continue
+		}
+		switch v := v.(type) {
+		case string:
+			values[a.Name] = []string{v}
+		case []any:
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("argument %q must be an array of strings", a.Name)
+				}
+				values[a.Name] = append(values[a.Name], s)
+			}
+		default:
+			return nil, fmt.Errorf("argument %q must be a string", a.Name)
+		}
+	}
+	return cmd.positionalArgs(values)
+}
+
+// parseValue converts a single JSON value to the type of the field.
+func parseValue(f *Field, v any) (any, error) {
+	switch f.Type {
+	case Boolean:
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+		return nil, fmt.Errorf("parameter %q must be a boolean", f.Name)
+	case Number:
+		if n, ok := v.(json.Number); ok {
+			if i, err := n.Int64(); err == nil {
+				return i, nil
+			}
+			if x, err := n.Float64(); err == nil {
+				return x, nil
+			}
+		}
+		return nil, fmt.Errorf("parameter %q must be a number", f.Name)
+	default:
+		s, ok := v.(string)
+		if !ok {
+			return nil, fmt.Errorf("parameter %q must be a string", f.Name)
+		}
+		return f.parse(s)
+	}
+}
+
+// parseMap converts a JSON object to the pairs of a map field. Values must be
+// strings, numbers or booleans.
+func parseMap(f *Field, v any) (map[string]any, error) {
+	obj, ok := v.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("parameter %q must be an object", f.Name)
+	}
+	pairs := map[string]any{}
+	for k, item := range obj {
+		switch item.(type) {
+		case string, json.Number, bool:
+		default:
+			return nil, fmt.Errorf("values of parameter %q must be strings, numbers or booleans", f.Name)
+		}
+		pair, err := f.parse(fmt.Sprintf("%s=%v", k, item))
+		if err != nil {
+			return nil, err
+		}
+		key, _, _ := strings.Cut(pair, "=")
+		pairs[key] = item
+	}
+	return pairs, nil
+}
+
+// valueStrings converts the parameter values to the strings passed to the
+// command, by field name.
+func valueStrings(values []paramValue) map[string][]string {
+	strs := map[string][]string{}
+	for _, v := range values {
+		if pairs, ok := v.value.(map[string]any); ok {
+			var keys []string
+			for k := range pairs {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			for _, k := range keys {
+				strs[v.field.Name] = append(strs[v.field.Name], k+"="+formatValue(pairs[k]))
+			}
+			continue
+		}
+		items, ok := v.value.([]any)
+		if !ok {
+			items = []any{v.value}
+		}
+		for _, item := range items {
+			strs[v.field.Name] = append(strs[v.field.Name], formatValue(item))
+		}
+	}
+	return strs
+}
+
+func formatValue(v any) string {
+	if f, ok := v.(float64); ok {
+		return strconv.FormatFloat(f, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// decodeJSON decodes a JSON request body, keeping numbers as json.Number so
+// integers don't lose precision.
+func decodeJSON(r io.Reader, v any) error {
+	dec := json.NewDecoder(r)
+	dec.UseNumber()
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		log.Println("webcli: couldn't encode response:", err)
+	}
+}
+
+func apiError(w http.ResponseWriter, msg string, code int) {
+	log.Println(msg)
+	writeJSON(w, code, map[string]string{"error": msg})
+}
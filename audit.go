@@ -0,0 +1,268 @@
+package webcli
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igolaizola/webcli/pkg/view"
+)
+
+// AuditEvent is an entry of the audit log.
+type AuditEvent struct {
+	Time    time.Time `json:"time"`
+	User    string    `json:"user"`
+	Action  Action    `json:"action"`
+	Command string    `json:"command"`
+	// Args are the arguments of a launched run.
+	Args []string `json:"args,omitempty"`
+	// RunID is the ID of the launched or canceled run.
+	RunID string `json:"run_id,omitempty"`
+	// Changes are the changes of a saved config.
+	Changes []ConfigChange `json:"changes,omitempty"`
+}
+
+// ConfigChange is a change of a value of a saved config.
+type ConfigChange struct {
+	Field string `json:"field"`
+	Old   any    `json:"old,omitempty"`
+	New   any    `json:"new,omitempty"`
+}
+
+// AuditFilter selects audit events. Empty fields match any event.
+type AuditFilter struct {
+	User    string
+	Command string
+	// From is the time of the first events that match.
+	From time.Time
+	// To is the end of the events that match, events at that time or later
+	// don't match.
+	To time.Time
+}
+
+// Match reports whether the event matches the filter.
+func (f AuditFilter) Match(e *AuditEvent) bool {
+	switch {
+	case f.User != "" && e.User != f.User:
+		return false
+	case f.Command != "" && e.Command != f.Command:
+		return false
+	case !f.From.IsZero() && e.Time.Before(f.From):
+		return false
+	case !f.To.IsZero() && !e.Time.Before(f.To):
+		return false
+	}
+	return true
+}
+
+// AuditSink records the audit log of the actions performed by users.
+type AuditSink interface {
+	// Record appends an event to the audit log.
+	Record(e *AuditEvent) error
+	// Query returns the events that match the filter, from newest to oldest.
+	Query(f AuditFilter) ([]*AuditEvent, error)
+}
+
+type fileAuditSink struct {
+	lck  sync.Mutex
+	path string
+}
+
+// NewFileAuditSink returns an audit sink that appends the events to a file,
+// one JSON object per line.
+func NewFileAuditSink(path string) AuditSink {
+	return &fileAuditSink{path: path}
+}
+
+func (s *fileAuditSink) Record(e *AuditEvent) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("webcli: couldn't marshal audit event: %w", err)
+	}
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("webcli: couldn't create folder %s: %w", filepath.Dir(s.path), err)
+	}
+	f, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("webcli: couldn't open audit file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write(append(b, '\n')); err != nil {
+		return fmt.Errorf("webcli: couldn't write audit file: %w", err)
+	}
+	return nil
+}
+
+func (s *fileAuditSink) Query(filter AuditFilter) ([]*AuditEvent, error) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	f, err := os.Open(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("webcli: couldn't open audit file: %w", err)
+	}
+	defer f.Close()
+
+	var events []*AuditEvent
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(nil, 16<<20)
+	for scanner.Scan() {
+		var e AuditEvent
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			log.Println("webcli: couldn't unmarshal audit event:", err)
+			continue
+		}
+		if filter.Match(&e) {
+			events = append(events, &e)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("webcli: couldn't read audit file: %w", err)
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+type memoryAuditSink struct {
+	lck    sync.Mutex
+	events []*AuditEvent
+}
+
+// NewMemoryAuditSink returns an audit sink that keeps the events in memory.
+// Events are lost when the server is restarted.
+func NewMemoryAuditSink() AuditSink {
+	return &memoryAuditSink{}
+}
+
+func (s *memoryAuditSink) Record(e *AuditEvent) error {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	copied := *e
+	s.events = append(s.events, &copied)
+	return nil
+}
+
+func (s *memoryAuditSink) Query(filter AuditFilter) ([]*AuditEvent, error) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	var events []*AuditEvent
+	for _, e := range s.events {
+		if filter.Match(e) {
+			copied := *e
+			events = append(events, &copied)
+		}
+	}
+	sortEvents(events)
+	return events, nil
+}
+
+// sortEvents orders events from newest to oldest.
+func sortEvents(events []*AuditEvent) {
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].Time.After(events[j].Time)
+	})
+}
+
+// configChanges returns the changes between two versions of a config.
+func configChanges(old, new map[string]any) []ConfigChange {
+	keys := map[string]struct{}{}
+	for k := range old {
+		keys[k] = struct{}{}
+	}
+	for k := range new {
+		keys[k] = struct{}{}
+	}
+	var names []string
+	for k := range keys {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	var changes []ConfigChange
+	for _, name := range names {
+		o, oldOK := old[name]
+		n, newOK := new[name]
+		if oldOK == newOK && fmt.Sprint(o) == fmt.Sprint(n) {
+			continue
+		}
+		changes = append(changes, ConfigChange{Field: name, Old: o, New: n})
+	}
+	return changes
+}
+
+// audit records an event performed by the user of the request.
+func (o *options) audit(r *http.Request, e *AuditEvent) {
+	if o.auditSink == nil {
+		return
+	}
+	e.Time = time.Now().UTC()
+	e.User = UserFromContext(r.Context())
+	if err := o.auditSink.Record(e); err != nil {
+		log.Println("webcli:", err)
+	}
+}
+
+// auditEntry converts an audit event to the entry shown in the audit page.
+func auditEntry(e *AuditEvent) view.AuditEntry {
+	var details []string
+	if e.RunID != "" {
+		details = append(details, fmt.Sprintf("Run %s", e.RunID))
+	}
+	if len(e.Args) > 0 {
+		details = append(details, strings.Join(e.Args, " "))
+	}
+	for _, c := range e.Changes {
+		details = append(details, fmt.Sprintf("%s: %s → %s", c.Field, changeValue(c.Old), changeValue(c.New)))
+	}
+	action := string(e.Action)
+	if action != "" {
+		action = strings.ToUpper(action[:1]) + action[1:]
+	}
+	return view.AuditEntry{
+		Time:    e.Time,
+		User:    e.User,
+		Action:  action,
+		Command: e.Command,
+		Details: strings.Join(details, "\n"),
+	}
+}
+
+func changeValue(v any) string {
+	if v == nil {
+		return "(unset)"
+	}
+	return fmt.Sprint(v)
+}
+
+// parseFilterTime parses the times of the audit page filter, in the format of
+// datetime-local inputs.
+func parseFilterTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.ParseInLocation("2006-01-02T15:04", s, time.Local)
+}
+
+// parseFilterEnd parses the end time of the audit page filter. Inputs only
+// have minutes, so the end is the start of the next minute to include the
+// events of the whole minute.
+func parseFilterEnd(s string) (time.Time, error) {
+	t, err := parseFilterTime(s)
+	if err != nil || t.IsZero() {
+		return t, err
+	}
+	return t.Add(time.Minute), nil
+}
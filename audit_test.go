@@ -0,0 +1,43 @@
+package webcli
+
+import (
+	"testing"
+	"time"
+)
+
+func TestAuditFilterTimes(t *testing.T) {
+	from, err := parseFilterTime("2024-05-01T10:00")
+	if err != nil {
+		t.Fatal(err)
+	}
+	to, err := parseFilterEnd("2024-05-01T10:30")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filter := AuditFilter{From: from, To: to}
+	at := func(hour, min, sec int) time.Time {
+		return time.Date(2024, 5, 1, hour, min, sec, 0, time.Local)
+	}
+	tests := []struct {
+		name string
+		time time.Time
+		want bool
+	}{
+		{"before start", at(9, 59, 59), false},
+		{"at start", at(10, 0, 0), true},
+		{"inside end minute", at(10, 30, 45), true},
+		{"after end minute", at(10, 31, 0), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := filter.Match(&AuditEvent{Time: tt.time}); got != tt.want {
+				t.Errorf("Match(%s) = %v, want %v", tt.time.Format(time.TimeOnly), got, tt.want)
+			}
+		})
+	}
+
+	// Empty times match any event
+	if end, err := parseFilterEnd(""); err != nil || !end.IsZero() {
+		t.Errorf("parseFilterEnd(\"\") = %v, %v, want zero time", end, err)
+	}
+}
@@ -0,0 +1,365 @@
+package webcli
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/igolaizola/webcli/pkg/view"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnauthenticated is returned by authenticators when the request doesn't
+// carry valid credentials.
+var ErrUnauthenticated = errors.New("webcli: unauthenticated")
+
+// Authenticator authenticates the requests to the server.
+type Authenticator interface {
+	// Authenticate returns the name of the user that made the request, or
+	// ErrUnauthenticated if the request doesn't carry valid credentials.
+	Authenticate(r *http.Request) (string, error)
+}
+
+// PasswordAuthenticator is implemented by authenticators that can check the
+// credentials entered in the login page.
+type PasswordAuthenticator interface {
+	Authenticator
+	// Login returns the name of the user identified by the credentials, or
+	// ErrUnauthenticated if they aren't valid.
+	Login(user, password string) (string, error)
+}
+
+// UserFromContext returns the name of the authenticated user of a request, or
+// an empty string if authentication is disabled.
+func UserFromContext(ctx context.Context) string {
+	return view.UserFromContext(ctx)
+}
+
+type basicAuthenticator struct {
+	hashes map[string][]byte
+}
+
+// NewBasicAuthenticator returns an authenticator that uses HTTP Basic
+// authentication with the users of an htpasswd file.
+// Only bcrypt hashes are supported, as generated by `htpasswd -B`.
+func NewBasicAuthenticator(path string) (Authenticator, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("webcli: couldn't open htpasswd file: %w", err)
+	}
+	defer f.Close()
+
+	hashes := map[string][]byte{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("webcli: invalid htpasswd line %d", n)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("webcli: htpasswd line %d isn't a bcrypt hash", n)
+		}
+		hashes[user] = []byte(hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("webcli: couldn't read htpasswd file: %w", err)
+	}
+	return &basicAuthenticator{hashes: hashes}, nil
+}
+
+func (a *basicAuthenticator) Authenticate(r *http.Request) (string, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	return a.Login(user, password)
+}
+
+func (a *basicAuthenticator) Login(user, password string) (string, error) {
+	hash, ok := a.hashes[user]
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil {
+		return "", ErrUnauthenticated
+	}
+	return user, nil
+}
+
+type tokenAuthenticator struct {
+	tokens map[string]string
+}
+
+// NewTokenAuthenticator returns an authenticator that accepts static bearer
+// tokens sent in the Authorization header.
+// The tokens map contains the name of the user of each token.
+// In the login page, the token is entered as the password.
+func NewTokenAuthenticator(tokens map[string]string) Authenticator {
+	return &tokenAuthenticator{tokens: tokens}
+}
+
+func (a *tokenAuthenticator) Authenticate(r *http.Request) (string, error) {
+	auth := r.Header.Get("Authorization")
+	token, ok := strings.CutPrefix(auth, "Bearer ")
+	if !ok {
+		return "", ErrUnauthenticated
+	}
+	return a.Login("", token)
+}
+
+func (a *tokenAuthenticator) Login(_, password string) (string, error) {
+	for token, user := range a.tokens {
+		if subtle.ConstantTimeCompare([]byte(token), []byte(password)) == 1 {
+			return user, nil
+		}
+	}
+	return "", ErrUnauthenticated
+}
+
+type proxyAuthenticator struct {
+	header  string
+	trusted []*net.IPNet
+}
+
+// NewProxyAuthenticator returns an authenticator that trusts the user set by
+// a reverse proxy in a header, "X-Forwarded-User" if header is empty.
+// The header is only trusted when the request comes from one of the given
+// CIDRs, e.g. "127.0.0.1/32" or "10.0.0.0/8".
+func NewProxyAuthenticator(header string, trusted ...string) (Authenticator, error) {
+	if header == "" {
+		header = "X-Forwarded-User"
+	}
+	a := &proxyAuthenticator{header: header}
+	for _, cidr := range trusted {
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("webcli: invalid CIDR %q: %w", cidr, err)
+		}
+		a.trusted = append(a.trusted, ipNet)
+	}
+	return a, nil
+}
+
+func (a *proxyAuthenticator) Authenticate(r *http.Request) (string, error) {
+	user := r.Header.Get(a.header)
+	if user == "" {
+		return "", ErrUnauthenticated
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return "", ErrUnauthenticated
+	}
+	for _, ipNet := range a.trusted {
+		if ipNet.Contains(ip) {
+			return user, nil
+		}
+	}
+	return "", ErrUnauthenticated
+}
+
+const (
+	sessionCookie   = "webcli_session"
+	sessionDuration = 24 * time.Hour
+)
+
+// auth protects the handlers with the configured authenticators.
+// Browser users without credentials are sent to the login page, and
+// successful logins are kept in a signed session cookie.
+type auth struct {
+	app            string
+	authenticators []Authenticator
+	key            []byte
+}
+
+func newAuth(app string, authenticators []Authenticator) (*auth, error) {
+	// Sessions are signed with a random key, so they don't survive restarts
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("webcli: couldn't generate session key: %w", err)
+	}
+	return &auth{
+		app:            app,
+		authenticators: authenticators,
+		key:            key,
+	}, nil
+}
+
+// authenticate returns the user of the request from the session cookie or
+// the authenticators.
+func (a *auth) authenticate(r *http.Request) (string, bool) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if user, ok := a.verifySession(c.Value); ok {
+			return user, true
+		}
+	}
+	for _, authenticator := range a.authenticators {
+		user, err := authenticator.Authenticate(r)
+		if err == nil {
+			return user, true
+		}
+		if !errors.Is(err, ErrUnauthenticated) {
+			log.Println("webcli: couldn't authenticate:", err)
+		}
+	}
+	return "", false
+}
+
+// login checks the credentials with the authenticators that support it.
+func (a *auth) login(user, password string) (string, bool) {
+	for _, authenticator := range a.authenticators {
+		p, ok := authenticator.(PasswordAuthenticator)
+		if !ok {
+			continue
+		}
+		name, err := p.Login(user, password)
+		if err == nil {
+			return name, true
+		}
+		if !errors.Is(err, ErrUnauthenticated) {
+			log.Println("webcli: couldn't authenticate:", err)
+		}
+	}
+	return "", false
+}
+
+// hasLogin reports whether any authenticator supports the login page.
+func (a *auth) hasLogin() bool {
+	for _, authenticator := range a.authenticators {
+		if _, ok := authenticator.(PasswordAuthenticator); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *auth) sign(payload string) string {
+	mac := hmac.New(sha256.New, a.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// newSession returns the value of a session cookie for the user.
+func (a *auth) newSession(user string) string {
+	expiry := strconv.FormatInt(time.Now().Add(sessionDuration).Unix(), 10)
+	payload := base64.RawURLEncoding.EncodeToString([]byte(user)) + "." + expiry
+	return payload + "." + a.sign(payload)
+}
+
+func (a *auth) verifySession(value string) (string, bool) {
+	i := strings.LastIndex(value, ".")
+	if i < 0 {
+		return "", false
+	}
+	payload, sig := value[:i], value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(a.sign(payload))) {
+		return "", false
+	}
+	encoded, expiry, ok := strings.Cut(payload, ".")
+	if !ok {
+		return "", false
+	}
+	unix, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return "", false
+	}
+	user, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", false
+	}
+	return string(user), true
+}
+
+// handler wraps the handler to require authentication.
+func (a *auth) handler(next http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/login", a.loginHandler)
+	mux.HandleFunc("/logout", func(w http.ResponseWriter, r *http.Request) {
+		http.SetCookie(w, &http.Cookie{
+			Name:     sessionCookie,
+			Path:     "/",
+			MaxAge:   -1,
+			HttpOnly: true,
+		})
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+	})
+	mux.Handle("/static/", next)
+	mux.Handle("/", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, ok := a.authenticate(r)
+		if ok {
+			ctx := view.WithUser(r.Context(), user)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/api/"):
+			w.Header().Set("WWW-Authenticate", `Basic realm="webcli"`)
+			apiError(w, "unauthorized", http.StatusUnauthorized)
+		case strings.HasPrefix(r.URL.Path, "/events/"):
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		case r.Header.Get("HX-Request") != "":
+			// Let htmx load the whole login page
+			w.Header().Set("HX-Redirect", "/login")
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			u := "/login?next=" + url.QueryEscape(r.URL.RequestURI())
+			http.Redirect(w, r, u, http.StatusSeeOther)
+		}
+	}))
+	return mux
+}
+
+func (a *auth) loginHandler(w http.ResponseWriter, r *http.Request) {
+	next := r.FormValue("next")
+	// Only allow local redirects
+	if !strings.HasPrefix(next, "/") || strings.HasPrefix(next, "//") || strings.HasPrefix(next, "/\\") {
+		next = "/"
+	}
+
+	var errMsg string
+	if r.Method == http.MethodPost {
+		user, ok := a.login(r.FormValue("username"), r.FormValue("password"))
+		if ok {
+			http.SetCookie(w, &http.Cookie{
+				Name:     sessionCookie,
+				Value:    a.newSession(user),
+				Path:     "/",
+				MaxAge:   int(sessionDuration.Seconds()),
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+			http.Redirect(w, r, next, http.StatusSeeOther)
+			return
+		}
+		errMsg = "Invalid username or password"
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+
+	v := view.Login(a.app, next, errMsg, a.hasLogin())
+	if err := v.Render(r.Context(), w); err != nil {
+		log.Println("webcli: couldn't render view:", err)
+	}
+}
@@ -0,0 +1,113 @@
+package webcli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/igolaizola/webcli/pkg/view"
+)
+
+// errPathNotAllowed is returned when browsing a path outside the browse roots.
+var errPathNotAllowed = errors.New("webcli: path not allowed")
+
+// allowedPath resolves an absolute path, following symlinks, and returns it
+// along with the browse root that contains it.
+func (o *options) allowedPath(path string) (string, string, error) {
+	if !filepath.IsAbs(path) {
+		return "", "", fmt.Errorf("webcli: path %s isn't absolute", path)
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Clean(path))
+	if err != nil {
+		return "", "", fmt.Errorf("webcli: couldn't resolve path %s: %w", path, err)
+	}
+	for _, root := range o.browseRoots {
+		rel, err := filepath.Rel(root, resolved)
+		if err != nil {
+			continue
+		}
+		if rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, root, nil
+		}
+	}
+	return "", "", errPathNotAllowed
+}
+
+// browse lists the entries of a directory for the browser of a field.
+// The browse roots are listed if the path is empty and the directory of the
+// path is listed if it is a file.
+func (o *options) browse(cmd *parsedCommand, f *Field, path string) (view.Browser, error) {
+	b := view.Browser{
+		Command:   cmd.Name,
+		Field:     f.Name,
+		SelectDir: f.Type == Directory,
+	}
+	if path == "" {
+		for _, root := range o.browseRoots {
+			b.Entries = append(b.Entries, view.BrowseEntry{Name: root, Path: root, Dir: true})
+		}
+		return b, nil
+	}
+
+	dir, root, err := o.allowedPath(path)
+	if err != nil {
+		return b, err
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		return b, fmt.Errorf("webcli: couldn't stat %s: %w", dir, err)
+	}
+	if !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return b, fmt.Errorf("webcli: couldn't read directory %s: %w", dir, err)
+	}
+
+	b.Dir = dir
+	if dir != root {
+		b.Parent = filepath.Dir(dir)
+	}
+	var files []view.BrowseEntry
+	for _, e := range entries {
+		// Hidden files aren't listed
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		entry := view.BrowseEntry{
+			Name: e.Name(),
+			Path: filepath.Join(dir, e.Name()),
+		}
+		// Symlinks are listed as the type of their target
+		if info, err := os.Stat(entry.Path); err == nil {
+			entry.Dir = info.IsDir()
+		}
+		switch {
+		case entry.Dir:
+			b.Entries = append(b.Entries, entry)
+		case f.Type == File && f.hasExtension(entry.Name):
+			files = append(files, entry)
+		}
+	}
+	// Directories are listed first
+	b.Entries = append(b.Entries, files...)
+	return b, nil
+}
+
+// hasExtension reports whether the file name has one of the extensions of the
+// field.
+func (f *Field) hasExtension(name string) bool {
+	if len(f.Extensions) == 0 {
+		return true
+	}
+	ext := filepath.Ext(name)
+	for _, e := range f.Extensions {
+		if strings.EqualFold(ext, "."+strings.TrimPrefix(e, ".")) {
+			return true
+		}
+	}
+	return false
+}
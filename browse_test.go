@@ -0,0 +1,80 @@
+package webcli
+
+import (
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestAllowedPath(t *testing.T) {
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := filepath.Join(tmp, "root")
+	outside := filepath.Join(tmp, "outside")
+	for _, dir := range []string{filepath.Join(root, "sub"), outside, root + "-other"} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "sub"), filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	o := &options{browseRoots: []string{root}}
+
+	tests := []struct {
+		name string
+		path string
+		want string
+		err  error
+	}{
+		{"root", root, root, nil},
+		{"subdirectory", filepath.Join(root, "sub"), filepath.Join(root, "sub"), nil},
+		{"symlink inside root", filepath.Join(root, "link"), filepath.Join(root, "sub"), nil},
+		{"traversal inside root", filepath.Join(root, "sub") + "/../sub", filepath.Join(root, "sub"), nil},
+		{"traversal outside root", root + "/sub/../../outside", "", errPathNotAllowed},
+		{"absolute path outside root", outside, "", errPathNotAllowed},
+		{"sibling with root prefix", root + "-other", "", errPathNotAllowed},
+		{"symlink escaping root", filepath.Join(root, "escape"), "", errPathNotAllowed},
+		{"relative path", "root/sub", "", errors.New("not absolute")},
+		{"missing path", filepath.Join(root, "missing"), "", errors.New("not found")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, gotRoot, err := o.allowedPath(tt.path)
+			switch {
+			case tt.err == nil && err != nil:
+				t.Fatalf("allowedPath(%s) error = %v", tt.path, err)
+			case tt.err != nil && err == nil:
+				t.Fatalf("allowedPath(%s) = %s, want error", tt.path, got)
+			case errors.Is(tt.err, errPathNotAllowed) && !errors.Is(err, errPathNotAllowed):
+				t.Fatalf("allowedPath(%s) error = %v, want %v", tt.path, err, errPathNotAllowed)
+			}
+			if got != tt.want {
+				t.Errorf("allowedPath(%s) = %s, want %s", tt.path, got, tt.want)
+			}
+			if tt.err == nil && gotRoot != root {
+				t.Errorf("allowedPath(%s) root = %s, want %s", tt.path, gotRoot, root)
+			}
+		})
+	}
+}
+
+func TestBrowseForbidden(t *testing.T) {
+	cmds := []*Command{{Name: "load", Fields: []*Field{{Name: "path", Type: File}}}}
+	s, _ := newTestServer(t, cmds, WithBrowseRoots(t.TempDir()),
+		WithPolicy(&Policy{DefaultDeny: true}))
+
+	// Unknown commands can't be told apart from forbidden ones
+	for _, name := range []string{"load", "missing"} {
+		if rec := serve(s, http.MethodGet, "/browse?field=path&command="+name, nil); rec.Code != http.StatusForbidden {
+			t.Errorf("GET /browse for %s = %d, want %d", name, rec.Code, http.StatusForbidden)
+		}
+	}
+}
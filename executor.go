@@ -0,0 +1,188 @@
+package webcli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+	"time"
+)
+
+// Executor launches the commands requested from the web interface.
+type Executor interface {
+	// Start launches a command. The arguments contain the path of the command
+	// followed by its flags, e.g. ["run", "subrun", "--attempts=3"].
+	Start(ctx context.Context, args []string) (Execution, error)
+}
+
+// Execution is a command launched by an executor.
+type Execution interface {
+	// Output returns a reader for stdout, which also includes stderr unless
+	// the execution implements StderrReader.
+	Output() io.Reader
+	// Stdin returns a writer for the standard input.
+	Stdin() io.WriteCloser
+	// Wait waits for the command to exit and returns its exit status.
+	// It must be called after reading all the output.
+	// A command exiting with a non-zero code isn't considered an error.
+	Wait() (ExitStatus, error)
+}
+
+// StderrReader is implemented by executions that keep stderr separated from
+// stdout, such as the ones of NewSelfExecutor and NewCommandExecutor. Both
+// streams are stored and shown tagged, so they can be told apart.
+type StderrReader interface {
+	// Stderr returns a reader for stderr.
+	Stderr() io.Reader
+}
+
+// Terminal is implemented by executions attached to a terminal, such as the
+// ones of NewPTYExecutor. Their output is shown in a terminal emulator in the
+// browser, which sends the keystrokes to the standard input.
+type Terminal interface {
+	// Resize changes the window size of the terminal.
+	Resize(cols, rows int) error
+}
+
+// Signaler is implemented by executions that can receive signals, such as the
+// ones of NewSelfExecutor, NewCommandExecutor and NewPTYExecutor. Canceled
+// commands are sent a stop signal and given a grace period to exit (see
+// WithGracePeriod); other executions are stopped by canceling their context.
+type Signaler interface {
+	// Signal sends a signal to the command and the processes it spawned.
+	Signal(sig os.Signal) error
+}
+
+// ExitStatus describes how an execution ended.
+type ExitStatus struct {
+	// Code is the exit code of the command, or -1 if it was terminated by a
+	// signal.
+	Code int
+	// Signal is the name of the signal that terminated the command, if any.
+	Signal string
+	// UserTime is the user CPU time consumed by the command.
+	UserTime time.Duration
+	// SystemTime is the system CPU time consumed by the command.
+	SystemTime time.Duration
+}
+
+// ExecutorFunc is an adapter to allow the use of ordinary functions as
+// executors.
+type ExecutorFunc func(ctx context.Context, args []string) (Execution, error)
+
+// Start calls f(ctx, args).
+func (f ExecutorFunc) Start(ctx context.Context, args []string) (Execution, error) {
+	return f(ctx, args)
+}
+
+// NewSelfExecutor returns an executor that starts another instance of the
+// current executable with the provided arguments.
+// This is the default executor.
+func NewSelfExecutor() Executor {
+	return ExecutorFunc(func(ctx context.Context, args []string) (Execution, error) {
+		// Get the path to the currently running executable
+		exePath, err := os.Executable()
+		if err != nil {
+			return nil, fmt.Errorf("error getting executable path: %w", err)
+		}
+		return launch(ctx, exePath, args)
+	})
+}
+
+// NewCommandExecutor returns an executor that runs the given binary with the
+// prefix arguments followed by the command arguments.
+// It can be used to run a different binary or to wrap the call, e.g.
+// NewCommandExecutor("sudo", "-u", "app", "/usr/local/bin/app") or
+// NewCommandExecutor("docker", "run", "--rm", "-i", "app:latest").
+func NewCommandExecutor(name string, prefix ...string) Executor {
+	return ExecutorFunc(func(ctx context.Context, args []string) (Execution, error) {
+		all := append(append([]string{}, prefix...), args...)
+		return launch(ctx, name, all)
+	})
+}
+
+// NewFuncExecutor returns an executor that runs the commands in-process,
+// calling fn in a new goroutine.
+// Everything written to output is shown as the output of the command and the
+// returned error is used as the result of the execution.
+func NewFuncExecutor(fn func(ctx context.Context, args []string, stdin io.Reader, output io.Writer) error) Executor {
+	return ExecutorFunc(func(ctx context.Context, args []string) (Execution, error) {
+		outputReader, outputWriter := io.Pipe()
+		stdinReader, stdinWriter := io.Pipe()
+		done := make(chan error, 1)
+		go func() {
+			err := fn(ctx, args, stdinReader, outputWriter)
+			if err != nil {
+				// Print the error as a CLI would do before exiting
+				fmt.Fprintln(outputWriter, err)
+			}
+			_ = stdinReader.Close()
+			_ = outputWriter.Close()
+			done <- err
+		}()
+		return &funcExecution{
+			output: outputReader,
+			stdin:  stdinWriter,
+			done:   done,
+		}, nil
+	})
+}
+
+type funcExecution struct {
+	output *io.PipeReader
+	stdin  io.WriteCloser
+	done   chan error
+}
+
+func (e *funcExecution) Output() io.Reader     { return e.output }
+func (e *funcExecution) Stdin() io.WriteCloser { return e.stdin }
+
+func (e *funcExecution) Wait() (ExitStatus, error) {
+	// Close the output so pending writes don't block the function forever
+	_ = e.output.Close()
+	if err := <-e.done; err != nil {
+		return ExitStatus{Code: 1}, nil
+	}
+	return ExitStatus{}, nil
+}
+
+// processExitStatus obtains the exit status from the state of an exited
+// process.
+func processExitStatus(state *os.ProcessState) ExitStatus {
+	status := ExitStatus{
+		Code:       state.ExitCode(),
+		UserTime:   state.UserTime(),
+		SystemTime: state.SystemTime(),
+	}
+	if ws, ok := state.Sys().(interface {
+		Signaled() bool
+		Signal() syscall.Signal
+	}); ok && ws.Signaled() {
+		status.Signal = signalName(ws.Signal())
+	}
+	return status
+}
+
+var signalNames = map[syscall.Signal]string{
+	syscall.SIGABRT: "SIGABRT",
+	syscall.SIGALRM: "SIGALRM",
+	syscall.SIGBUS:  "SIGBUS",
+	syscall.SIGFPE:  "SIGFPE",
+	syscall.SIGHUP:  "SIGHUP",
+	syscall.SIGILL:  "SIGILL",
+	syscall.SIGINT:  "SIGINT",
+	syscall.SIGKILL: "SIGKILL",
+	syscall.SIGPIPE: "SIGPIPE",
+	syscall.SIGQUIT: "SIGQUIT",
+	syscall.SIGSEGV: "SIGSEGV",
+	syscall.SIGTERM: "SIGTERM",
+	syscall.SIGTRAP: "SIGTRAP",
+}
+
+func signalName(sig syscall.Signal) string {
+	if name, ok := signalNames[sig]; ok {
+		return name
+	}
+	return sig.String()
+}
@@ -4,9 +4,11 @@ go 1.22
 
 require (
 	github.com/a-h/templ v0.2.680
+	github.com/gorilla/websocket v1.5.3
 	github.com/peterbourgon/ff/v3 v3.3.0
 	github.com/spf13/cobra v1.8.0
 	github.com/spf13/pflag v1.0.5
+	golang.org/x/crypto v0.22.0
 	gopkg.in/yaml.v3 v3.0.1
 )
 
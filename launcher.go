@@ -1,6 +1,7 @@
 package webcli
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
@@ -11,23 +12,182 @@ import (
 	"strings"
 	"sync"
 	"time"
+
+	"github.com/igolaizola/webcli/pkg/ansi"
+	"github.com/igolaizola/webcli/pkg/view"
 )
 
+// defaultGracePeriod is the default time given to canceled commands to exit
+// before they are killed.
+const defaultGracePeriod = 10 * time.Second
+
 type process struct {
-	logs      string
+	logs      *logBuffer
 	callbacks map[string]func(string, bool)
-	listening context.CancelFunc
-	lck       sync.Mutex
-	command   string
-	start     time.Time
-	end       time.Time
-	error     bool
-	cancel    context.CancelFunc
-	canceled  bool
+	// Subscribers to the raw output, used by the terminal
+	rawCallbacks map[string]func([]byte, bool)
+	listening    context.CancelFunc
+	lck          sync.Mutex
+	cancel       context.CancelFunc
+	output       io.WriteCloser
+	formatter    logFormatter
+	// seq is the sequence number of the last published record
+	seq int64
+
+	// Standard input of the process, nil once closed
+	stdinLck sync.Mutex
+	stdin    io.WriteCloser
+
+	// Terminal the process is attached to, if any
+	terminal Terminal
+
+	// Graceful stop of the process, if it can receive signals
+	signaler    Signaler
+	stopSignal  os.Signal
+	gracePeriod time.Duration
+
+	// Record of the run, updated when the process ends
+	stateLck sync.Mutex
+	run      Run
+	store    RunStore
+	done     chan struct{}
+}
+
+// errInputClosed is returned when sending input to a process whose standard
+// input is closed.
+var errInputClosed = errors.New("webcli: input is closed")
+
+// Input writes a line to the standard input of the process, and closes it
+// afterwards if eof is set. Sent lines are recorded in the run.
+func (p *process) Input(line string, eof bool) error {
+	p.stdinLck.Lock()
+	defer p.stdinLck.Unlock()
+	if p.stdin == nil || !p.Run().End.IsZero() {
+		return errInputClosed
+	}
+	// Sending only EOF doesn't write an empty line
+	if line != "" || !eof {
+		if _, err := io.WriteString(p.stdin, line+"\n"); err != nil {
+			return fmt.Errorf("webcli: couldn't write input: %w", err)
+		}
+	}
+	if eof {
+		if err := p.stdin.Close(); err != nil {
+			log.Println("webcli: couldn't close input:", err)
+		}
+		p.stdin = nil
+	}
+	p.update(func(run *Run) {
+		run.Input = append(run.Input, RunInput{
+			Time: time.Now().UTC(),
+			Line: line,
+			EOF:  eof,
+		})
+	})
+	return nil
+}
+
+// WriteTerminal writes the keystrokes received from the terminal in the
+// browser to the standard input. Unlike lines sent with Input, they aren't
+// recorded in the run.
+func (p *process) WriteTerminal(data []byte) error {
+	p.stdinLck.Lock()
+	defer p.stdinLck.Unlock()
+	if p.stdin == nil || !p.Run().End.IsZero() {
+		return errInputClosed
+	}
+	if _, err := p.stdin.Write(data); err != nil {
+		return fmt.Errorf("webcli: couldn't write input: %w", err)
+	}
+	return nil
+}
+
+// Resize changes the window size of the terminal of the process.
+func (p *process) Resize(cols, rows int) error {
+	if p.terminal == nil {
+		return errors.New("webcli: process isn't attached to a terminal")
+	}
+	return p.terminal.Resize(cols, rows)
+}
+
+// Stop asks the process to exit, sending the stop signal to it and the
+// processes it spawned. It is killed if it is still running after the grace
+// period, or right away if it can't receive signals.
+// Nothing is done if the run has already ended, as its process group may
+// have been reused.
+func (p *process) Stop() {
+	ended, stopping := p.markStopping()
+	if ended || stopping {
+		return
+	}
+	if p.signaler == nil || p.gracePeriod < 0 {
+		p.cancel()
+		return
+	}
+	if err := p.signaler.Signal(p.stopSignal); err != nil {
+		log.Println("webcli: couldn't send stop signal:", err)
+		p.cancel()
+		return
+	}
+	go func() {
+		select {
+		case <-p.done:
+		case <-time.After(p.gracePeriod):
+			p.cancel()
+		}
+	}()
+}
+
+// Kill kills the process and the processes it spawned without waiting for
+// them to exit.
+func (p *process) Kill() {
+	if ended, _ := p.markStopping(); ended {
+		return
+	}
+	p.cancel()
+}
+
+// markStopping marks the run as stopping unless it has already ended. It
+// reports whether the run had ended and whether it was already stopping.
+func (p *process) markStopping() (ended, stopping bool) {
+	p.stateLck.Lock()
+	defer p.stateLck.Unlock()
+	if !p.run.End.IsZero() {
+		return true, false
+	}
+	if p.run.Stopping {
+		return false, true
+	}
+	p.run.Stopping = true
+	run := p.run
+	if err := p.store.Update(&run); err != nil {
+		log.Println("webcli:", err)
+	}
+	return false, false
+}
+
+// update modifies the record of the run and stores it.
+func (p *process) update(fn func(run *Run)) {
+	p.stateLck.Lock()
+	defer p.stateLck.Unlock()
+	fn(&p.run)
+	run := p.run
+	if err := p.store.Update(&run); err != nil {
+		log.Println("webcli:", err)
+	}
+}
+
+// Done returns a channel that is closed when the process ends and its run
+// has been stored.
+func (p *process) Done() <-chan struct{} {
+	return p.done
 }
 
-func (p *process) Logs() string {
-	return p.logs
+// Logs returns the last output of the process formatted as HTML and its
+// position in the full output.
+func (p *process) Logs() (string, int64) {
+	data, offset := p.logs.Tail()
+	return formatLogs(data, p.Run().Start), offset
 }
 
 func (p *process) Subscribe(id string, callback func(string, bool)) {
@@ -37,13 +197,127 @@ func (p *process) Subscribe(id string, callback func(string, bool)) {
 	p.callbacks[id] = callback
 }
 
+// SubscribeRaw subscribes to the raw output of the process and returns the
+// last output kept in memory. The callback receives the output that follows
+// it, and is called with close set when the process ends.
+func (p *process) SubscribeRaw(id string, callback func([]byte, bool)) []byte {
+	defer p.listening()
+	p.lck.Lock()
+	defer p.lck.Unlock()
+	p.rawCallbacks[id] = callback
+	data, _ := p.logs.Tail()
+	return outputText(data, "")
+}
+
 func (p *process) Unsubscribe(id string) {
 	p.lck.Lock()
 	defer p.lck.Unlock()
 	delete(p.callbacks, id)
+	delete(p.rawCallbacks, id)
+}
+
+// Run returns a copy of the record of the run.
+func (p *process) Run() *Run {
+	p.stateLck.Lock()
+	defer p.stateLck.Unlock()
+	run := p.run
+	return &run
+}
+
+// Entry returns the log entry that describes the process.
+func (p *process) Entry() view.LogEntry {
+	return runEntry(p.Run())
+}
+
+// runEntry converts a run to the log entry shown in the web interface.
+func runEntry(run *Run) view.LogEntry {
+	var input []string
+	var inputClosed bool
+	for _, in := range run.Input {
+		if in.Line != "" || !in.EOF {
+			input = append(input, in.Line)
+		}
+		inputClosed = inputClosed || in.EOF
+	}
+	return view.LogEntry{
+		ID:          run.ID,
+		Command:     run.Command,
+		Start:       run.Start,
+		End:         run.End,
+		Error:       run.Error,
+		Canceled:    run.Canceled,
+		Interrupted: run.Interrupted,
+		ExitCode:    run.ExitCode,
+		Signal:      run.Signal,
+		CPUTime:     run.UserTime + run.SystemTime,
+		Input:       input,
+		InputClosed: inputClosed,
+		Terminal:    run.Terminal,
+		Stopping:    run.Stopping,
+	}
+}
+
+func (p *process) notify(text string, close bool) {
+	p.lck.Lock()
+	defer p.lck.Unlock()
+	for _, callback := range p.callbacks {
+		callback(text, close)
+	}
+	if close {
+		for _, callback := range p.rawCallbacks {
+			callback(nil, true)
+		}
+	}
+}
+
+// publish stores a line written to a stream, keeps it in memory and sends it
+// to all subscribers, each line as a separate event.
+// Everything happens under the same lock so records are numbered and stored
+// in order, and new subscribers don't miss or repeat any output.
+func (p *process) publish(stream string, text []byte, received time.Time, partial bool) {
+	p.lck.Lock()
+	defer p.lck.Unlock()
+	p.seq++
+	rec := LogRecord{
+		Seq:     p.seq,
+		Time:    received,
+		Stream:  stream,
+		Text:    string(text),
+		Partial: partial,
+	}
+	line := encodeRecord(rec)
+	if _, err := p.output.Write(line); err != nil {
+		log.Println("webcli: couldn't store output:", err)
+	}
+	_, _ = p.logs.Write(line)
+	for _, callback := range p.rawCallbacks {
+		callback([]byte(rec.Text), false)
+	}
+	if html := p.formatter.format(rec); html != "" {
+		for _, callback := range p.callbacks {
+			callback(html, false)
+		}
+	}
 }
 
-func newProcess(ctx context.Context, args []string, debug bool) (*process, error) {
+// flush sends to the subscribers the output kept by the formatter.
+func (p *process) flush() {
+	p.lck.Lock()
+	defer p.lck.Unlock()
+	if html := p.formatter.flush(); html != "" {
+		for _, callback := range p.callbacks {
+			callback(html, false)
+		}
+	}
+}
+
+// newProcess launches a process with the given arguments, where the first one
+// is the command name.
+// The redacted arguments, without the values of secret fields, are the ones
+// stored and shown to users, along with the redacted effective arguments.
+// The grace period is the time given to the process to exit when it is
+// stopped.
+func newProcess(ctx context.Context, id string, args, redacted, effective []string, gracePeriod time.Duration, o *options) (*process, error) {
 	if len(args) == 0 {
 		return nil, errors.New("no command provided")
 	}
@@ -52,36 +326,81 @@ func newProcess(ctx context.Context, args []string, debug bool) (*process, error
 	cmdName := args[0]
 	parts := strings.Split(cmdName, "/")
 	args = append(parts, args[1:]...)
+	redacted = append(parts, redacted[1:]...)
+	if len(effective) > 0 {
+		effective = append(parts, effective[1:]...)
+	}
+
+	// Store the run
+	run := Run{
+		ID:            id,
+		Command:       cmdName,
+		Args:          redacted,
+		EffectiveArgs: effective,
+		Start:         time.Now().UTC(),
+	}
+	stored, err := o.runStore.Create(&run)
+	if err != nil {
+		return nil, fmt.Errorf("error storing run: %w", err)
+	}
 
 	// Launch the process
-	start := time.Now().UTC()
 	ctx, cancel := context.WithCancel(ctx)
-	combinedOutput, _, err := launch(ctx, args)
+	execution, err := o.executor.Start(ctx, args)
 	if err != nil {
 		cancel()
+		_ = stored.Close()
+		run.Error = true
+		run.End = time.Now().UTC()
+		if err := o.runStore.Update(&run); err != nil {
+			log.Println("webcli:", err)
+		}
 		return nil, fmt.Errorf("error launching instance: %w", err)
 	}
-	if debug {
-		output := fmt.Sprintf("> %s\n", strings.Join(args, " "))
+
+	// Executions attached to a terminal are shown in a terminal emulator
+	terminal, _ := execution.(Terminal)
+	if terminal != nil {
+		run.Terminal = true
+		if err := o.runStore.Update(&run); err != nil {
+			log.Println("webcli:", err)
+		}
+	}
+
+	// Executions may keep stderr separated from stdout
+	stdout := execution.Output()
+	if o.debug {
+		output := fmt.Sprintf("> %s\n", strings.Join(redacted, " "))
 		log.Println(output)
-		combinedOutput = io.MultiReader(strings.NewReader(output), combinedOutput)
+		stdout = io.MultiReader(strings.NewReader(output), stdout)
+	}
+	streams := map[string]io.Reader{Stdout: stdout}
+	if e, ok := execution.(StderrReader); ok {
+		streams[Stderr] = e.Stderr()
 	}
 
 	// Create the process that handles the output
 	waitListening, listening := context.WithCancel(ctx)
 	p := &process{
-		callbacks: make(map[string]func(string, bool)),
-		start:     start,
-		command:   cmdName,
-		listening: listening,
-		cancel:    cancel,
+		logs:         newLogBuffer(o.logBufferSize),
+		callbacks:    make(map[string]func(string, bool)),
+		rawCallbacks: make(map[string]func([]byte, bool)),
+		listening:    listening,
+		cancel:       cancel,
+		output:       stored,
+		formatter:    logFormatter{start: run.Start},
+		stdin:        execution.Stdin(),
+		run:          run,
+		store:        o.runStore,
+		done:         make(chan struct{}),
+		terminal:     terminal,
+		stopSignal:   o.stopSignal,
+		gracePeriod:  gracePeriod,
 	}
+	p.signaler, _ = execution.(Signaler)
 
 	go func() {
 		defer cancel()
-		defer func() {
-			p.end = time.Now().UTC()
-		}()
 
 		// Wait for first subscription or timeout
 		select {
@@ -89,84 +408,178 @@ func newProcess(ctx context.Context, args []string, debug bool) (*process, error
 		case <-time.After(500 * time.Millisecond):
 		}
 
-		for {
-			select {
-			case <-ctx.Done():
-				if errors.Is(ctx.Err(), context.Canceled) {
-					p.canceled = true
-				}
-				return
-			default:
+		// Read the output until the process ends
+		readErr := p.readStreams(ctx, streams)
+
+		// Wait for the process to exit and obtain its status
+		status, waitErr := execution.Wait()
+		if waitErr != nil {
+			log.Println("webcli: couldn't wait for process:", waitErr)
+		}
+		if err := p.output.Close(); err != nil {
+			log.Println("webcli: couldn't close output:", err)
+		}
+
+		// Store the final state of the run
+		p.update(func(run *Run) {
+			run.End = time.Now().UTC()
+			run.ExitCode = status.Code
+			run.Signal = status.Signal
+			run.UserTime = status.UserTime
+			run.SystemTime = status.SystemTime
+			run.Error = readErr != nil || waitErr != nil || status.Code != 0
+			if run.Stopping || errors.Is(ctx.Err(), context.Canceled) {
+				run.Canceled = true
 			}
+			run.Stopping = false
+		})
+
+		// Notify subscribers that the process has ended
+		p.notify("", true)
+		close(p.done)
+	}()
 
-			// Read the output of the process
-			data := make([]byte, 1024)
-			var text string
-			n, err := combinedOutput.Read(data)
-			if err != nil {
-				if !errors.Is(err, io.EOF) {
-					p.error = true
-				}
-				text = err.Error()
-			} else {
-				text = string(data[:n])
+	return p, nil
+}
+
+// readStreams reads all the output streams concurrently until they end or
+// the context is done.
+func (p *process) readStreams(ctx context.Context, streams map[string]io.Reader) error {
+	var wg sync.WaitGroup
+	errs := make([]error, 0, len(streams))
+	var errsLck sync.Mutex
+	for stream, output := range streams {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := p.read(ctx, stream, output); err != nil {
+				errsLck.Lock()
+				errs = append(errs, err)
+				errsLck.Unlock()
 			}
-			text = strings.ReplaceAll(text, "\n", "<br>")
+		}()
+	}
+	wg.Wait()
+	p.flush()
+	return errors.Join(errs...)
+}
+
+// read reads the output of a stream and sends it to the subscribers line by
+// line until the output ends or the context is done.
+func (p *process) read(ctx context.Context, stream string, output io.Reader) error {
+	// The output of terminals is published as it is read instead, so the
+	// keystrokes are echoed right away
+	write := func(data []byte) {
+		p.publish(stream, data, time.Now().UTC(), false)
+	}
+	if p.terminal == nil {
+		lines := newLineSplitter(func(text []byte, received time.Time, partial bool) {
+			p.publish(stream, text, received, partial)
+		})
+		defer lines.Close()
+		write = lines.Write
+	}
 
-			// Store the output
-			p.logs += text
+	var pending []byte
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		default:
+		}
 
-			// Send the output to all subscribers
-			p.lck.Lock()
-			for _, callback := range p.callbacks {
-				callback(text, err != nil)
+		// Read the output of the process
+		data := make([]byte, 1024)
+		n, err := output.Read(data)
+		data = append(pending, data[:n]...)
+		pending = nil
+		if err == nil {
+			// Keep an incomplete character for the next read
+			if k := ansi.IncompleteRune(data); k > 0 {
+				pending = bytes.Clone(data[len(data)-k:])
+				data = data[:len(data)-k]
 			}
-			p.lck.Unlock()
-
-			// Exit if the process has ended
-			if err != nil {
-				if errors.Is(ctx.Err(), context.Canceled) {
-					p.canceled = true
-				}
-				return
+		} else if !errors.Is(err, io.EOF) {
+			data = append(data, err.Error()...)
+		}
+
+		if len(data) > 0 {
+			write(data)
+		}
+
+		// Exit if the output has ended
+		if err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
 			}
+			return err
 		}
-	}()
+	}
+}
 
-	return p, nil
+type cmdExecution struct {
+	cmd    *exec.Cmd
+	stdout io.Reader
+	stderr io.Reader
+	stdin  io.WriteCloser
 }
 
-// Launch starts another instance of the current executable with provided arguments.
-// It returns a single reader for both stdout and stderr, and a writer for stdin.
-func launch(ctx context.Context, args []string) (combinedOutput io.Reader, stdin io.Writer, err error) {
-	// Get the path to the currently running executable
-	exePath, err := os.Executable()
-	if err != nil {
-		return nil, nil, fmt.Errorf("error getting executable path: %w", err)
+func (e *cmdExecution) Output() io.Reader     { return e.stdout }
+func (e *cmdExecution) Stderr() io.Reader     { return e.stderr }
+func (e *cmdExecution) Stdin() io.WriteCloser { return e.stdin }
+
+func (e *cmdExecution) Signal(sig os.Signal) error {
+	return signalGroup(e.cmd, sig)
+}
+
+func (e *cmdExecution) Wait() (ExitStatus, error) {
+	err := e.cmd.Wait()
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return ExitStatus{Code: -1}, err
 	}
+	return processExitStatus(e.cmd.ProcessState), nil
+}
 
-	// Create the command with the context and the arguments
-	cmd := exec.CommandContext(ctx, exePath, args...)
+// launch starts the binary with provided arguments.
+// It returns an execution with separate readers for stdout and stderr, and a
+// writer for stdin.
+func launch(ctx context.Context, name string, args []string) (*cmdExecution, error) {
+	// Create the command with the context and the arguments, in its own
+	// process group that is killed when the context is done
+	cmd := exec.CommandContext(ctx, name, args...)
+	setProcessGroup(cmd)
+	cmd.Cancel = func() error {
+		return signalGroup(cmd, os.Kill)
+	}
 
 	// Create a pipe for stdin
 	stdinPipe, err := cmd.StdinPipe()
 	if err != nil {
-		return nil, nil, fmt.Errorf("error creating stdin pipe: %w", err)
+		return nil, fmt.Errorf("error creating stdin pipe: %w", err)
 	}
 
-	// Set up a single pipe for stdout and stderr
+	// Create pipes for stdout and stderr
 	stdoutPipe, err := cmd.StdoutPipe()
 	if err != nil {
-		return nil, nil, fmt.Errorf("error creating stdout pipe: %w", err)
+		return nil, fmt.Errorf("error creating stdout pipe: %w", err)
+	}
+	stderrPipe, err := cmd.StderrPipe()
+	if err != nil {
+		return nil, fmt.Errorf("error creating stderr pipe: %w", err)
 	}
-	cmd.Stderr = cmd.Stdout // Redirect stderr to stdout
 
 	// Start the command
 	err = cmd.Start()
 	if err != nil {
-		return nil, nil, fmt.Errorf("error starting command: %w", err)
+		return nil, fmt.Errorf("error starting command: %w", err)
 	}
 
-	// Return the combined stdout/stderr pipe and the stdin pipe
-	return stdoutPipe, stdinPipe, nil
+	// Return the stdout, stderr and stdin pipes
+	return &cmdExecution{
+		cmd:    cmd,
+		stdout: stdoutPipe,
+		stderr: stderrPipe,
+		stdin:  stdinPipe,
+	}, nil
 }
@@ -0,0 +1,114 @@
+package webcli
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sync"
+)
+
+const (
+	// defaultLogBufferSize is the default amount of output kept in memory for
+	// each process.
+	defaultLogBufferSize = 1 << 20
+	// logPageSize is the amount of output loaded each time earlier output is
+	// requested.
+	logPageSize = 256 << 10
+)
+
+// logBuffer keeps the last bytes of the output of a process in memory.
+// The output is stored in chunks that are discarded, oldest first, when the
+// size limit is exceeded.
+type logBuffer struct {
+	lck    sync.Mutex
+	chunks [][]byte
+	size   int
+	max    int
+	// offset is the position in the full output of the first buffered byte
+	offset int64
+}
+
+func newLogBuffer(max int) *logBuffer {
+	return &logBuffer{max: max}
+}
+
+func (b *logBuffer) Write(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	b.lck.Lock()
+	defer b.lck.Unlock()
+	b.chunks = append(b.chunks, bytes.Clone(p))
+	b.size += len(p)
+
+	// Discard the oldest chunks until the buffer fits the limit
+	for b.size > b.max {
+		excess := b.size - b.max
+		first := b.chunks[0]
+		if len(first) > excess {
+			b.chunks[0] = first[excess:]
+			b.size -= excess
+			b.offset += int64(excess)
+			break
+		}
+		b.chunks = b.chunks[1:]
+		b.size -= len(first)
+		b.offset += int64(len(first))
+	}
+	return len(p), nil
+}
+
+// Tail returns the buffered output and its position in the full output.
+// If older output was discarded, the returned output starts at the beginning
+// of a line.
+func (b *logBuffer) Tail() ([]byte, int64) {
+	b.lck.Lock()
+	defer b.lck.Unlock()
+	data := bytes.Join(b.chunks, nil)
+	offset := b.offset
+	if offset > 0 {
+		data, offset = alignLine(data, offset)
+	}
+	return data, offset
+}
+
+// readBefore reads up to n bytes of output that end at the end position.
+// If end is negative, the output is read until its end.
+// It returns the data read and its position in the full output. Unless the
+// beginning of the output is reached, the data starts at the beginning of a
+// line.
+func readBefore(r io.ReadSeeker, end int64, n int) ([]byte, int64, error) {
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, 0, fmt.Errorf("webcli: couldn't seek output: %w", err)
+	}
+	if end < 0 || end > size {
+		end = size
+	}
+	start := end - int64(n)
+	if start < 0 {
+		start = 0
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, 0, fmt.Errorf("webcli: couldn't seek output: %w", err)
+	}
+	data := make([]byte, end-start)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, 0, fmt.Errorf("webcli: couldn't read output: %w", err)
+	}
+	if start > 0 {
+		data, start = alignLine(data, start)
+	}
+	return data, start, nil
+}
+
+// alignLine skips the partial line at the beginning of the data, so that
+// lines aren't shown broken.
+// If the data doesn't contain a full line, it is returned unchanged.
+func alignLine(data []byte, offset int64) ([]byte, int64) {
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 || i == len(data)-1 {
+		return data, offset
+	}
+	return data[i+1:], offset + int64(i+1)
+}
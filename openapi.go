@@ -0,0 +1,421 @@
+package webcli
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// openAPISpec generates the OpenAPI 3 document of the JSON API, with one
+// operation per command to launch it. Only the given commands are included,
+// so users don't see the commands hidden from them.
+func openAPISpec(o *options, cmds []*parsedCommand) map[string]any {
+	paths := map[string]any{
+		"/api/v1/commands": map[string]any{
+			"get": operation("listCommands", "List commands and their fields", "commands", nil, "200",
+				response("List of commands", arrayOf(ref("Command")))),
+		},
+		"/api/v1/runs": map[string]any{
+			"get": operation("listRuns", "List runs, from newest to oldest", "runs", nil, "200",
+				response("List of runs", arrayOf(ref("Run")))),
+		},
+		"/api/v1/runs/{id}": map[string]any{
+			"parameters": []any{idParameter},
+			"get": operation("getRun", "Get the status and exit code of a run", "runs", nil, "200",
+				response("Run", ref("Run"))),
+		},
+		"/api/v1/runs/{id}/logs": map[string]any{
+			"parameters": []any{
+				idParameter,
+				map[string]any{
+					"name":        "follow",
+					"in":          "query",
+					"description": "Stream the output until the run ends",
+					"schema":      map[string]any{"type": "boolean"},
+				},
+				map[string]any{
+					"name":        "stream",
+					"in":          "query",
+					"description": "Only get the output written to this stream",
+					"schema":      map[string]any{"type": "string", "enum": []string{"stdout", "stderr"}},
+				},
+			},
+			"get": map[string]any{
+				"operationId": "getRunLogs",
+				"summary":     "Get the output of a run",
+				"tags":        []string{"runs"},
+				"responses": map[string]any{
+					"200": map[string]any{
+						"description": "Output of the run",
+						"content": map[string]any{
+							"text/plain": map[string]any{
+								"schema": map[string]any{"type": "string"},
+							},
+						},
+					},
+					"404": errorResponse,
+				},
+			},
+		},
+		"/api/v1/runs/{id}/cancel": map[string]any{
+			"parameters": []any{
+				idParameter,
+				map[string]any{
+					"name":        "force",
+					"in":          "query",
+					"description": "Kill the run right away instead of sending the stop signal and waiting for the grace period",
+					"schema":      map[string]any{"type": "boolean"},
+				},
+			},
+			"post": operation("cancelRun", "Cancel a run", "runs", nil, "202",
+				response("Run being canceled", ref("Run"))),
+		},
+		"/api/v1/runs/{id}/input": map[string]any{
+			"parameters": []any{idParameter},
+			"post": operation("sendInput", "Send a line to the standard input of a run", "runs", ref("Input"), "200",
+				response("Run", ref("Run"))),
+		},
+	}
+
+	for _, cmd := range cmds {
+		id := operationName(cmd.Name)
+		summary := cmd.Description
+		if summary == "" {
+			summary = fmt.Sprintf("Launch %s", cmd.Name)
+		}
+		schema := paramsSchema(cmd)
+		paths["/api/v1/commands/"+cmd.Name] = map[string]any{
+			"get": operation("getCommand_"+id, fmt.Sprintf("Get the fields and arguments of %s", cmd.Name), "commands", nil, "200",
+				response("Command", ref("Command"))),
+			"post": operation("run_"+id, summary, "commands", launchSchema(cmd), "201",
+				response("Launched run", ref("Run"))),
+		}
+		if !o.disableConfig {
+			paths["/api/v1/configs/"+cmd.Name] = map[string]any{
+				"get": operation("getConfig_"+id, fmt.Sprintf("Read the saved config of %s", cmd.Name), "configs", nil, "200",
+					response("Saved config", schema)),
+				"put": operation("putConfig_"+id, fmt.Sprintf("Write the saved config of %s", cmd.Name), "configs", schema, "200",
+					response("Saved config", schema)),
+			}
+		}
+	}
+
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   o.app,
+			"version": "1.0.0",
+		},
+		"paths": paths,
+		"components": map[string]any{
+			"schemas": map[string]any{
+				"Command": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name":        map[string]any{"type": "string"},
+						"description": map[string]any{"type": "string"},
+						"fields":      arrayOf(ref("Field")),
+						"args":        arrayOf(ref("Arg")),
+					},
+				},
+				"Arg": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name":        map[string]any{"type": "string"},
+						"description": map[string]any{"type": "string"},
+						"required":    map[string]any{"type": "boolean"},
+						"variadic":    map[string]any{"type": "boolean"},
+						"options":     arrayOf(map[string]any{"type": "string"}),
+					},
+				},
+				"Field": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"name":        map[string]any{"type": "string"},
+						"type":        map[string]any{"type": "string"},
+						"array":       map[string]any{"type": "boolean"},
+						"default":     map[string]any{"type": "string"},
+						"description": map[string]any{"type": "string"},
+						"options":     arrayOf(map[string]any{"type": "string"}),
+						"extensions":  arrayOf(map[string]any{"type": "string"}),
+					},
+				},
+				"Input": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"time": map[string]any{"type": "string", "format": "date-time", "readOnly": true},
+						"line": map[string]any{"type": "string"},
+						"eof":  map[string]any{"type": "boolean", "description": "Close the input after the line"},
+					},
+				},
+				"Run": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"id":      map[string]any{"type": "string"},
+						"command": map[string]any{"type": "string"},
+						"args":    arrayOf(map[string]any{"type": "string"}),
+						"effective_args": map[string]any{
+							"type":        "array",
+							"items":       map[string]any{"type": "string"},
+							"description": "Arguments including the defaults of the flags that weren't passed",
+						},
+						"start":       map[string]any{"type": "string", "format": "date-time"},
+						"end":         map[string]any{"type": "string", "format": "date-time"},
+						"error":       map[string]any{"type": "boolean"},
+						"canceled":    map[string]any{"type": "boolean"},
+						"stopping":    map[string]any{"type": "boolean", "description": "Whether the run was canceled and is being given time to exit"},
+						"interrupted": map[string]any{"type": "boolean"},
+						"exit_code":   map[string]any{"type": "integer"},
+						"signal":      map[string]any{"type": "string"},
+						"user_time":   map[string]any{"type": "integer", "description": "User CPU time in nanoseconds"},
+						"system_time": map[string]any{"type": "integer", "description": "System CPU time in nanoseconds"},
+						"input":       arrayOf(ref("Input")),
+						"terminal":    map[string]any{"type": "boolean", "description": "Whether the command was attached to a terminal"},
+						"status": map[string]any{
+							"type": "string",
+							"enum": []string{"running", "stopping", "completed", "failed", "canceled", "interrupted"},
+						},
+					},
+				},
+				"Error": map[string]any{
+					"type": "object",
+					"properties": map[string]any{
+						"error": map[string]any{"type": "string"},
+					},
+				},
+			},
+		},
+	}
+}
+
+var idParameter = map[string]any{
+	"name":     "id",
+	"in":       "path",
+	"required": true,
+	"schema":   map[string]any{"type": "string"},
+}
+
+var errorResponse = map[string]any{
+	"description": "Error",
+	"content": map[string]any{
+		"application/json": map[string]any{
+			"schema": ref("Error"),
+		},
+	},
+}
+
+// operation returns an operation with an optional JSON request body and its
+// successful response.
+func operation(id, summary, tag string, body map[string]any, status string, ok map[string]any) map[string]any {
+	op := map[string]any{
+		"operationId": id,
+		"summary":     summary,
+		"tags":        []string{tag},
+		"responses": map[string]any{
+			status: ok,
+			"400":  errorResponse,
+			"404":  errorResponse,
+		},
+	}
+	if body != nil {
+		op["requestBody"] = map[string]any{
+			"content": map[string]any{
+				"application/json": map[string]any{
+					"schema": body,
+				},
+			},
+		}
+	}
+	return op
+}
+
+func response(description string, schema map[string]any) map[string]any {
+	return map[string]any{
+		"description": description,
+		"content": map[string]any{
+			"application/json": map[string]any{
+				"schema": schema,
+			},
+		},
+	}
+}
+
+func ref(name string) map[string]any {
+	return map[string]any{"$ref": "#/components/schemas/" + name}
+}
+
+func arrayOf(items map[string]any) map[string]any {
+	return map[string]any{"type": "array", "items": items}
+}
+
+// operationName converts a command name to a valid operation ID.
+func operationName(name string) string {
+	return strings.NewReplacer("/", "_", "-", "_", " ", "_").Replace(name)
+}
+
+// paramsSchema returns the schema of the parameters of a command. Uploads
+// can't be set through the API, so they aren't included.
+func paramsSchema(cmd *parsedCommand) map[string]any {
+	properties := map[string]any{}
+	for _, f := range cmd.Fields {
+		if f.Type == Upload {
+			continue
+		}
+		properties[f.Name] = fieldSchema(f)
+	}
+	return map[string]any{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	}
+}
+
+// launchSchema returns the schema of the parameters and positional arguments
+// used to launch a command.
+func launchSchema(cmd *parsedCommand) map[string]any {
+	schema := paramsSchema(cmd)
+	properties := schema["properties"].(map[string]any)
+	var required []string
+	for _, f := range cmd.Fields {
+		if f.Required && f.Type != Boolean && f.Type != Upload {
+			required = append(required, f.Name)
+		}
+	}
+	for _, a := range cmd.Args {
+		// Flags take precedence over arguments with the same name
+		if _, ok := properties[a.Name]; ok {
+			continue
+		}
+		argSchema := map[string]any{"type": "string"}
+		if len(a.Options) > 0 {
+			argSchema["enum"] = a.Options
+		}
+		if a.Variadic {
+			argSchema = arrayOf(argSchema)
+		}
+		if a.Description != "" {
+			argSchema["description"] = a.Description
+		}
+		properties[a.Name] = argSchema
+		if a.Required {
+			required = append(required, a.Name)
+		}
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+// fieldSchema returns the schema of a field, with its default value.
+func fieldSchema(f *Field) map[string]any {
+	if f.Type == Map {
+		return mapSchema(f)
+	}
+	schema := map[string]any{"type": fieldSchemaType(f.Type)}
+	switch f.Type {
+	case Enum:
+		schema["enum"] = f.Options
+	case Duration:
+		schema["format"] = "duration"
+	case Time:
+		schema["format"] = "date-time"
+	case Date:
+		schema["format"] = "date"
+	case Size:
+		schema["pattern"] = sizeRegexp.String()
+	}
+	if f.Min != nil {
+		schema["minimum"] = *f.Min
+	}
+	if f.Max != nil {
+		schema["maximum"] = *f.Max
+	}
+	if f.Pattern != "" {
+		schema["pattern"] = "^(?:" + f.Pattern + ")$"
+	}
+	// Secret values are masked, in each item of arrays
+	if f.Secret {
+		schema["format"] = "password"
+	}
+	if f.Array {
+		schema = arrayOf(schema)
+	}
+	if f.Description != "" {
+		schema["description"] = f.Description
+	}
+	if f.Secret {
+		return schema
+	}
+	if def, ok := defaultValue(f); ok {
+		schema["default"] = def
+	}
+	return schema
+}
+
+// mapSchema returns the schema of a map field, an object of key/value pairs.
+func mapSchema(f *Field) map[string]any {
+	schema := map[string]any{
+		"type":                 "object",
+		"additionalProperties": map[string]any{"type": "string"},
+	}
+	if f.Description != "" {
+		schema["description"] = f.Description
+	}
+	if f.Secret {
+		return schema
+	}
+	def := map[string]any{}
+	for _, pair := range f.defaults() {
+		if k, v, ok := strings.Cut(pair, "="); ok {
+			def[k] = v
+		}
+	}
+	schema["default"] = def
+	return schema
+}
+
+func fieldSchemaType(t FieldType) string {
+	switch t {
+	case Number:
+		return "number"
+	case Boolean:
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+// defaultValue converts the default value of a field to its type.
+func defaultValue(f *Field) (any, bool) {
+	if !f.Array {
+		return parseDefault(f.Type, f.Default)
+	}
+	list := []any{}
+	for _, v := range f.defaults() {
+		value, ok := parseDefault(f.Type, v)
+		if !ok {
+			return nil, false
+		}
+		list = append(list, value)
+	}
+	return list, true
+}
+
+func parseDefault(t FieldType, v string) (any, bool) {
+	switch t {
+	case Number:
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return n, true
+		}
+		if n, err := strconv.ParseFloat(v, 64); err == nil {
+			return n, true
+		}
+		return nil, false
+	case Boolean:
+		b, err := strconv.ParseBool(v)
+		return b, err == nil
+	default:
+		return v, true
+	}
+}
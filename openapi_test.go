@@ -0,0 +1,49 @@
+package webcli
+
+import "testing"
+
+func TestFieldSchemaSecret(t *testing.T) {
+	tests := []struct {
+		name  string
+		field *Field
+	}{
+		{"single", &Field{Name: "token", Type: Text, Secret: true, Default: "hidden"}},
+		{"array", &Field{Name: "tokens", Type: Text, Secret: true, Array: true, Default: "hidden"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			schema := fieldSchema(tt.field)
+			if _, ok := schema["default"]; ok {
+				t.Errorf("schema has a default value: %v", schema)
+			}
+			// Arrays mask each of their items
+			if tt.field.Array {
+				items, ok := schema["items"].(map[string]any)
+				if !ok {
+					t.Fatalf("schema has no items: %v", schema)
+				}
+				if _, ok := schema["format"]; ok {
+					t.Errorf("array schema has a format: %v", schema)
+				}
+				schema = items
+			}
+			if schema["format"] != "password" {
+				t.Errorf("format = %v, want password", schema["format"])
+			}
+		})
+	}
+}
+
+func TestOpenAPICommandPaths(t *testing.T) {
+	cmds := []*parsedCommand{{Name: "db/migrate"}}
+	spec := openAPISpec(&options{app: "test"}, cmds)
+	path, ok := spec["paths"].(map[string]any)["/api/v1/commands/db/migrate"].(map[string]any)
+	if !ok {
+		t.Fatal("spec has no path for the command")
+	}
+	for _, method := range []string{"get", "post"} {
+		if _, ok := path[method]; !ok {
+			t.Errorf("command path has no %s operation", method)
+		}
+	}
+}
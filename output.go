@@ -0,0 +1,364 @@
+package webcli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/igolaizola/webcli/pkg/ansi"
+)
+
+// Streams of the output of a command.
+const (
+	Stdout = "stdout"
+	Stderr = "stderr"
+)
+
+// LogRecord is a line of output of a run, tagged with the stream it was
+// written to and the time it was received.
+// The output of the runs is stored as a sequence of records encoded as JSON,
+// one per line.
+type LogRecord struct {
+	// Seq is the position of the record in the output of the run, starting
+	// at 1.
+	Seq    int64     `json:"seq"`
+	Time   time.Time `json:"time"`
+	Stream string    `json:"stream"`
+	// Text is the line, including the trailing new line.
+	Text string `json:"text"`
+	// Partial is set if the line was published before it was complete,
+	// because the rest took too long to arrive or it was too long. The rest
+	// of the line is in the next records of the stream.
+	Partial bool `json:"partial,omitempty"`
+}
+
+const (
+	// partialLineTimeout is how long the beginning of a line is kept waiting
+	// for the rest of it before it is published, e.g. for prompts.
+	partialLineTimeout = 500 * time.Millisecond
+	// maxLineSize is the maximum size of a line, longer lines are split.
+	maxLineSize = 64 << 10
+)
+
+// lineSplitter splits the output of a stream into lines.
+// A partial line is published if the rest of it doesn't arrive before a
+// timeout.
+type lineSplitter struct {
+	lck sync.Mutex
+	buf []byte
+	// received is the time the first byte of the buffered line was received
+	received time.Time
+	timer    *time.Timer
+	// gen identifies the last write, so stale timers don't flush the buffer
+	gen     int
+	publish func(text []byte, received time.Time, partial bool)
+}
+
+func newLineSplitter(publish func(text []byte, received time.Time, partial bool)) *lineSplitter {
+	return &lineSplitter{publish: publish}
+}
+
+// Write publishes the complete lines of the output and keeps the rest until
+// the line is completed or the timeout expires.
+func (s *lineSplitter) Write(data []byte) {
+	now := time.Now().UTC()
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	if len(s.buf) == 0 {
+		s.received = now
+	}
+	s.buf = append(s.buf, data...)
+	for {
+		i := bytes.IndexByte(s.buf, '\n')
+		if i < 0 {
+			break
+		}
+		s.publish(s.buf[:i+1], s.received, false)
+		s.buf = s.buf[i+1:]
+		s.received = now
+	}
+	if len(s.buf) >= maxLineSize {
+		s.flush(false)
+	}
+
+	// Wait for the rest of the line
+	s.gen++
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	if len(s.buf) > 0 {
+		gen := s.gen
+		s.timer = time.AfterFunc(partialLineTimeout, func() {
+			s.lck.Lock()
+			defer s.lck.Unlock()
+			if gen == s.gen {
+				s.flush(false)
+			}
+		})
+	}
+}
+
+// Close publishes the rest of the output.
+func (s *lineSplitter) Close() {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	s.gen++
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	s.flush(true)
+}
+
+// flush publishes the buffered line. Unless the output has ended, it is
+// published as partial and an incomplete character at its end is kept.
+func (s *lineSplitter) flush(ended bool) {
+	n := len(s.buf)
+	if !ended {
+		n -= ansi.IncompleteRune(s.buf)
+	}
+	if n == 0 {
+		return
+	}
+	s.publish(s.buf[:n], s.received, !ended)
+	s.buf = append([]byte(nil), s.buf[n:]...)
+	s.received = time.Now().UTC()
+}
+
+// validStream reports whether the stream is a valid filter of the output,
+// where empty means all the streams.
+func validStream(stream string) bool {
+	return stream == "" || stream == Stdout || stream == Stderr
+}
+
+// encodeRecord returns the record encoded as a line of JSON.
+func encodeRecord(rec LogRecord) []byte {
+	b, err := json.Marshal(rec)
+	if err != nil {
+		// Records only contain strings and times, this can't happen
+		panic(fmt.Sprintf("webcli: couldn't encode log record: %v", err))
+	}
+	return append(b, '\n')
+}
+
+// decodeRecords decodes the records of stored output and returns them with
+// the number of bytes decoded.
+// Unless complete is set, a last line without a new line is considered a
+// record still being written, and it isn't decoded.
+// Lines that aren't records, written by older versions that stored the raw
+// output, are decoded as stdout.
+func decodeRecords(data []byte, complete bool) ([]LogRecord, int) {
+	var records []LogRecord
+	var n int
+	for n < len(data) {
+		line := data[n:]
+		i := bytes.IndexByte(line, '\n')
+		if i < 0 && !complete {
+			break
+		}
+		if i >= 0 {
+			line = line[:i+1]
+		}
+		n += len(line)
+
+		var rec LogRecord
+		if err := json.Unmarshal(line, &rec); err != nil || rec.Stream == "" {
+			rec = LogRecord{Stream: Stdout, Text: string(line)}
+		}
+		records = append(records, rec)
+	}
+	return records, n
+}
+
+// outputText returns the text of the records of the stream in the stored
+// output, or of all the records if the stream is empty.
+func outputText(data []byte, stream string) []byte {
+	records, _ := decodeRecords(data, true)
+	var b bytes.Buffer
+	for _, rec := range records {
+		if stream == "" || rec.Stream == stream {
+			b.WriteString(rec.Text)
+		}
+	}
+	return b.Bytes()
+}
+
+// copyOutput writes the text of the stored output of a run, starting at the
+// given position, filtered by stream if it isn't empty.
+// It returns the number of bytes of stored output consumed. Unless complete
+// is set, a record still being written is left for the next call.
+func copyOutput(w io.Writer, store RunStore, id string, pos int64, stream string, complete bool) (int64, error) {
+	output, err := store.Output(id)
+	if err != nil {
+		return 0, err
+	}
+	defer output.Close()
+	if _, err := output.Seek(pos, io.SeekStart); err != nil {
+		return 0, fmt.Errorf("webcli: couldn't seek output: %w", err)
+	}
+	data, err := io.ReadAll(output)
+	if err != nil {
+		return 0, fmt.Errorf("webcli: couldn't read output: %w", err)
+	}
+	records, n := decodeRecords(data, complete)
+	for _, rec := range records {
+		if stream != "" && rec.Stream != stream {
+			continue
+		}
+		if _, err := io.WriteString(w, rec.Text); err != nil {
+			return int64(n), err
+		}
+	}
+	return int64(n), nil
+}
+
+// formatLogs converts stored output to HTML, escaping it and converting ANSI
+// colors to styled spans. Lines show their time relative to the start of the
+// run, and partial lines are joined with the records that continue them.
+func formatLogs(data []byte, start time.Time) string {
+	records, _ := decodeRecords(data, true)
+	f := logFormatter{start: start}
+	type logLine struct {
+		rec       LogRecord
+		continues int64
+		content   strings.Builder
+	}
+	var lines []*logLine
+	open := map[int64]*logLine{}
+	add := func(rec LogRecord, content string, continues int64) {
+		if l, ok := open[continues]; ok {
+			l.content.WriteString(content)
+			return
+		}
+		// The start of the line may be in an earlier page of output
+		l := &logLine{rec: rec, continues: continues}
+		l.content.WriteString(content)
+		lines = append(lines, l)
+		if rec.Partial {
+			open[rec.Seq] = l
+		}
+	}
+	for _, rec := range records {
+		content, continues := f.convert(rec)
+		add(rec, content, continues)
+	}
+	for _, stream := range []string{Stdout, Stderr} {
+		if content, continues := f.flushStream(stream); content != "" {
+			add(LogRecord{Stream: stream}, content, continues)
+		}
+	}
+	var b strings.Builder
+	for _, l := range lines {
+		b.WriteString(f.line(l.rec, l.continues, l.content.String()))
+	}
+	return b.String()
+}
+
+// logFormatter converts records to HTML lines, keeping the style of each
+// stream between records. Each line is tagged with its stream and sequence
+// number, so the streams can be filtered and told apart, and shows its time
+// relative to the start of the run.
+// Records that continue a partial line are tagged with the sequence number of
+// the line they continue, so they are appended to it when shown.
+type logFormatter struct {
+	start      time.Time
+	converters map[string]*ansi.Converter
+	// open has the sequence number of the partial line of each stream
+	open map[string]int64
+}
+
+func (f *logFormatter) format(rec LogRecord) string {
+	content, continues := f.convert(rec)
+	return f.line(rec, continues, content)
+}
+
+// convert returns the HTML content of a record and the sequence number of the
+// partial line it continues, if any.
+func (f *logFormatter) convert(rec LogRecord) (string, int64) {
+	if f.converters == nil {
+		f.converters = map[string]*ansi.Converter{}
+		f.open = map[string]int64{}
+	}
+	c, ok := f.converters[rec.Stream]
+	if !ok {
+		c = &ansi.Converter{}
+		f.converters[rec.Stream] = c
+	}
+	continues := f.open[rec.Stream]
+	switch {
+	case !rec.Partial:
+		delete(f.open, rec.Stream)
+	case continues == 0:
+		f.open[rec.Stream] = rec.Seq
+	}
+	text := strings.TrimSuffix(rec.Text, "\n")
+	return c.Convert([]byte(text)), continues
+}
+
+// flush returns the HTML of the output kept by the converters.
+func (f *logFormatter) flush() string {
+	var b strings.Builder
+	for _, stream := range []string{Stdout, Stderr} {
+		if content, continues := f.flushStream(stream); content != "" {
+			b.WriteString(f.line(LogRecord{Stream: stream}, continues, content))
+		}
+	}
+	return b.String()
+}
+
+// flushStream returns the HTML of the output kept by the converter of a
+// stream and the sequence number of the partial line it continues, if any.
+func (f *logFormatter) flushStream(stream string) (string, int64) {
+	c, ok := f.converters[stream]
+	if !ok {
+		return "", 0
+	}
+	continues := f.open[stream]
+	delete(f.open, stream)
+	return c.Flush(), continues
+}
+
+// line renders the HTML of a record as a line. Output written to stderr is
+// highlighted.
+func (f *logFormatter) line(rec LogRecord, continues int64, content string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, `<div data-stream="%s"`, html.EscapeString(rec.Stream))
+	if rec.Seq > 0 {
+		fmt.Fprintf(&b, ` data-seq="%d"`, rec.Seq)
+	}
+	if continues > 0 {
+		fmt.Fprintf(&b, ` data-continues="%d"`, continues)
+	}
+	if rec.Stream == Stderr {
+		b.WriteString(` class="text-red-600"`)
+	}
+	b.WriteString(">")
+	// Continuations are shown after the time of the line they continue
+	if !rec.Time.IsZero() && !f.start.IsZero() && continues == 0 {
+		fmt.Fprintf(&b, `<span class="log-time select-none text-gray-400" title="%s">%s </span>`,
+			rec.Time.Local().Format(time.RFC3339Nano), relativeTime(rec.Time.Sub(f.start)))
+	}
+	// Empty lines keep their height
+	if content == "" && continues == 0 {
+		content = " "
+	}
+	b.WriteString(content)
+	b.WriteString("</div>")
+	return b.String()
+}
+
+// relativeTime formats the time elapsed since the start of a run, padded so
+// lines are aligned.
+func relativeTime(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	if d < time.Minute {
+		return fmt.Sprintf("%9s", fmt.Sprintf("+%.3fs", d.Seconds()))
+	}
+	return fmt.Sprintf("%9s", "+"+d.Truncate(time.Second).String())
+}
@@ -0,0 +1,45 @@
+package webcli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLogFormatterPartialLines(t *testing.T) {
+	records := []LogRecord{
+		{Seq: 1, Stream: Stdout, Text: "progress: ", Partial: true},
+		{Seq: 2, Stream: Stderr, Text: "warn\n"},
+		{Seq: 3, Stream: Stdout, Text: "50%", Partial: true},
+		{Seq: 4, Stream: Stdout, Text: " done\n"},
+		{Seq: 5, Stream: Stdout, Text: "next\n"},
+	}
+
+	// Published records are tagged with the line they continue
+	live := []string{
+		`<div data-stream="stdout" data-seq="1">progress: </div>`,
+		`<div data-stream="stderr" data-seq="2" class="text-red-600">warn</div>`,
+		`<div data-stream="stdout" data-seq="3" data-continues="1">50%</div>`,
+		`<div data-stream="stdout" data-seq="4" data-continues="1"> done</div>`,
+		`<div data-stream="stdout" data-seq="5">next</div>`,
+	}
+	var f logFormatter
+	for i, rec := range records {
+		if got := f.format(rec); got != live[i] {
+			t.Errorf("format(%d) = %q, want %q", rec.Seq, got, live[i])
+		}
+	}
+
+	// Stored records are joined to the line they continue
+	var data []byte
+	for _, rec := range records {
+		data = append(data, encodeRecord(rec)...)
+	}
+	stored := strings.Join([]string{
+		`<div data-stream="stdout" data-seq="1">progress: 50% done</div>`,
+		`<div data-stream="stderr" data-seq="2" class="text-red-600">warn</div>`,
+		`<div data-stream="stdout" data-seq="5">next</div>`,
+	}, "")
+	if got := formatLogs(data, records[0].Time); got != stored {
+		t.Errorf("formatLogs() = %q, want %q", got, stored)
+	}
+}
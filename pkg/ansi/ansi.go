@@ -0,0 +1,407 @@
+// Package ansi converts terminal output to HTML.
+//
+// Text is HTML-escaped and ANSI SGR sequences (colors, bold, italic,
+// underline...) are converted to styled spans. Any other escape sequence is
+// removed.
+package ansi
+
+import (
+	"fmt"
+	"html"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	esc = 0x1b
+	bel = 0x07
+	// maxPending is the maximum length of an incomplete escape sequence kept
+	// between calls to Convert.
+	maxPending = 256
+)
+
+// ToHTML converts a complete piece of terminal output to HTML.
+func ToHTML(data []byte) string {
+	var c Converter
+	return c.Convert(data) + c.Flush()
+}
+
+// Converter converts a stream of terminal output to HTML.
+// The style is kept between calls to Convert, so the output can be converted
+// in chunks.
+// The zero value is ready to use.
+type Converter struct {
+	style   style
+	pending []byte
+}
+
+// Convert converts the next chunk of output to HTML.
+// The returned HTML is self-contained: spans opened in the chunk are closed at
+// its end and reopened in the next one.
+// Incomplete escape sequences and characters at the end of the chunk are kept
+// until the next call.
+func (c *Converter) Convert(data []byte) string {
+	if len(c.pending) > 0 {
+		data = append(c.pending, data...)
+		c.pending = nil
+	}
+
+	w := &htmlWriter{style: c.style}
+	for len(data) > 0 {
+		i := indexControl(data)
+		if i < 0 {
+			i = len(data)
+			// Keep an incomplete character for the next chunk
+			if n := IncompleteRune(data); n > 0 {
+				i -= n
+				c.pending = append(c.pending, data[i:]...)
+			}
+		}
+		w.text(data[:i])
+		data = data[i:]
+		if len(c.pending) > 0 || len(data) == 0 {
+			break
+		}
+
+		switch data[0] {
+		case '\r':
+			// Carriage returns can't be represented, they are dropped
+			data = data[1:]
+			continue
+		case '\n':
+			w.raw("<br>")
+			data = data[1:]
+			continue
+		}
+
+		// Parse the escape sequence
+		n, params, final, ok := parseEscape(data)
+		if !ok {
+			// Keep the incomplete sequence for the next chunk, unless it
+			// is too long to be valid
+			if len(data) < maxPending {
+				c.pending = append(c.pending, data...)
+				break
+			}
+			data = data[1:]
+			continue
+		}
+		data = data[n:]
+		if final != 'm' {
+			continue
+		}
+		w.setStyle(w.style.apply(params))
+	}
+	c.style = w.style
+	return w.String()
+}
+
+// Flush returns the HTML of any output kept from previous calls to Convert
+// and resets the converter.
+func (c *Converter) Flush() string {
+	w := &htmlWriter{style: c.style}
+	w.text(c.pending)
+	*c = Converter{}
+	return w.String()
+}
+
+// htmlWriter writes HTML, opening a span for the current style only when
+// there is content to be styled.
+type htmlWriter struct {
+	b     strings.Builder
+	style style
+	open  bool
+}
+
+// text writes the HTML-escaped text, removing control characters.
+func (w *htmlWriter) text(text []byte) {
+	s := strings.Map(func(r rune) rune {
+		if r < 0x20 && r != '\t' {
+			return -1
+		}
+		return r
+	}, string(text))
+	w.raw(html.EscapeString(s))
+}
+
+func (w *htmlWriter) raw(s string) {
+	if s == "" {
+		return
+	}
+	if !w.open {
+		w.open = w.style.open(&w.b)
+	}
+	w.b.WriteString(s)
+}
+
+func (w *htmlWriter) setStyle(s style) {
+	if s == w.style {
+		return
+	}
+	w.closeSpan()
+	w.style = s
+}
+
+func (w *htmlWriter) closeSpan() {
+	if w.open {
+		w.b.WriteString("</span>")
+		w.open = false
+	}
+}
+
+// String closes the current span and returns the written HTML.
+func (w *htmlWriter) String() string {
+	w.closeSpan()
+	return w.b.String()
+}
+
+// indexControl returns the index of the first escape, new line or carriage
+// return character, or -1 if there is none.
+func indexControl(data []byte) int {
+	for i, c := range data {
+		if c == esc || c == '\n' || c == '\r' {
+			return i
+		}
+	}
+	return -1
+}
+
+// IncompleteRune returns the number of bytes at the end of the data that
+// belong to an incomplete UTF-8 character, which should be kept until the
+// rest of the character is read.
+func IncompleteRune(data []byte) int {
+	for n := 1; n < utf8.UTFMax && n <= len(data); n++ {
+		c := data[len(data)-n]
+		if c < utf8.RuneSelf {
+			return 0
+		}
+		if utf8.RuneStart(c) {
+			if utf8.FullRune(data[len(data)-n:]) {
+				return 0
+			}
+			return n
+		}
+	}
+	return 0
+}
+
+// parseEscape parses the escape sequence at the beginning of the data.
+// It returns its length, the parameters and final byte of CSI sequences, and
+// false if the sequence is incomplete.
+func parseEscape(data []byte) (int, string, byte, bool) {
+	if len(data) < 2 {
+		return 0, "", 0, false
+	}
+	switch data[1] {
+	case '[':
+		// CSI: parameter bytes, intermediate bytes and a final byte
+		for i := 2; i < len(data); i++ {
+			c := data[i]
+			if c >= 0x40 && c <= 0x7e {
+				return i + 1, string(data[2:i]), c, true
+			}
+			if c < 0x20 || c > 0x3f {
+				// Invalid sequence, discard the introducer
+				return 2, "", 0, true
+			}
+		}
+		return 0, "", 0, false
+	case ']':
+		// OSC: terminated by BEL or ST (ESC \)
+		for i := 2; i < len(data); i++ {
+			switch {
+			case data[i] == bel:
+				return i + 1, "", 0, true
+			case data[i] == esc && i+1 < len(data) && data[i+1] == '\\':
+				return i + 2, "", 0, true
+			case data[i] == esc && i+1 == len(data):
+				return 0, "", 0, false
+			}
+		}
+		return 0, "", 0, false
+	default:
+		// Two-byte sequence
+		return 2, "", 0, true
+	}
+}
+
+type style struct {
+	bold      bool
+	faint     bool
+	italic    bool
+	underline bool
+	strike    bool
+	inverse   bool
+	fg        string
+	bg        string
+}
+
+// apply returns the style after applying the SGR parameters.
+func (s style) apply(params string) style {
+	if params == "" {
+		return style{}
+	}
+	codes := strings.Split(strings.ReplaceAll(params, ":", ";"), ";")
+	for i := 0; i < len(codes); i++ {
+		code, err := strconv.Atoi(codes[i])
+		if err != nil {
+			code = 0
+		}
+		switch {
+		case code == 0:
+			s = style{}
+		case code == 1:
+			s.bold = true
+		case code == 2:
+			s.faint = true
+		case code == 3:
+			s.italic = true
+		case code == 4:
+			s.underline = true
+		case code == 7:
+			s.inverse = true
+		case code == 9:
+			s.strike = true
+		case code == 22:
+			s.bold, s.faint = false, false
+		case code == 23:
+			s.italic = false
+		case code == 24:
+			s.underline = false
+		case code == 27:
+			s.inverse = false
+		case code == 29:
+			s.strike = false
+		case code >= 30 && code <= 37:
+			s.fg = palette[code-30]
+		case code == 38:
+			var color string
+			color, i = extendedColor(codes, i)
+			if color != "" {
+				s.fg = color
+			}
+		case code == 39:
+			s.fg = ""
+		case code >= 40 && code <= 47:
+			s.bg = palette[code-40]
+		case code == 48:
+			var color string
+			color, i = extendedColor(codes, i)
+			if color != "" {
+				s.bg = color
+			}
+		case code == 49:
+			s.bg = ""
+		case code >= 90 && code <= 97:
+			s.fg = palette[code-90+8]
+		case code >= 100 && code <= 107:
+			s.bg = palette[code-100+8]
+		}
+	}
+	return s
+}
+
+// extendedColor parses a 256-color (5;n) or true color (2;r;g;b) parameter
+// that follows the code at index i.
+// It returns the color and the index of the last parameter consumed.
+func extendedColor(codes []string, i int) (string, int) {
+	if i+1 >= len(codes) {
+		return "", i
+	}
+	switch codes[i+1] {
+	case "5":
+		if i+2 >= len(codes) {
+			return "", len(codes)
+		}
+		n, err := strconv.Atoi(codes[i+2])
+		if err != nil || n < 0 || n > 255 {
+			return "", i + 2
+		}
+		return color256(n), i + 2
+	case "2":
+		if i+4 >= len(codes) {
+			return "", len(codes)
+		}
+		var rgb [3]int
+		for j := range rgb {
+			n, err := strconv.Atoi(codes[i+2+j])
+			if err != nil || n < 0 || n > 255 {
+				return "", i + 4
+			}
+			rgb[j] = n
+		}
+		return fmt.Sprintf("#%02x%02x%02x", rgb[0], rgb[1], rgb[2]), i + 4
+	default:
+		return "", i + 1
+	}
+}
+
+// open writes the opening span of the style and reports whether it was
+// needed.
+func (s style) open(b *strings.Builder) bool {
+	if s == (style{}) {
+		return false
+	}
+	fg, bg := s.fg, s.bg
+	if s.inverse {
+		fg, bg = bg, fg
+		if fg == "" {
+			fg = "#ffffff"
+		}
+		if bg == "" {
+			bg = "#000000"
+		}
+	}
+	var css []string
+	if fg != "" {
+		css = append(css, "color:"+fg)
+	}
+	if bg != "" {
+		css = append(css, "background-color:"+bg)
+	}
+	if s.bold {
+		css = append(css, "font-weight:bold")
+	}
+	if s.faint {
+		css = append(css, "opacity:0.7")
+	}
+	if s.italic {
+		css = append(css, "font-style:italic")
+	}
+	switch {
+	case s.underline && s.strike:
+		css = append(css, "text-decoration:underline line-through")
+	case s.underline:
+		css = append(css, "text-decoration:underline")
+	case s.strike:
+		css = append(css, "text-decoration:line-through")
+	}
+	fmt.Fprintf(b, `<span style="%s">`, strings.Join(css, ";"))
+	return true
+}
+
+// palette contains the 16 standard terminal colors.
+var palette = [16]string{
+	"#000000", "#cd3131", "#0dbc79", "#e5e510",
+	"#2472c8", "#bc3fbc", "#11a8cd", "#e5e5e5",
+	"#666666", "#f14c4c", "#23d18b", "#f5f543",
+	"#3b8eea", "#d670d6", "#29b8db", "#ffffff",
+}
+
+// color256 returns the color of the xterm 256-color palette.
+func color256(n int) string {
+	switch {
+	case n < 16:
+		return palette[n]
+	case n < 232:
+		// 6x6x6 color cube
+		n -= 16
+		levels := [6]int{0, 95, 135, 175, 215, 255}
+		return fmt.Sprintf("#%02x%02x%02x", levels[n/36], levels[n/6%6], levels[n%6])
+	default:
+		// Grayscale ramp
+		v := 8 + (n-232)*10
+		return fmt.Sprintf("#%02x%02x%02x", v, v, v)
+	}
+}
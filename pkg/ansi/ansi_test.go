@@ -0,0 +1,225 @@
+package ansi
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestToHTML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "plain text",
+			in:   "hello world",
+			want: "hello world",
+		},
+		{
+			name: "escape html",
+			in:   `<script>alert("x")</script> & more`,
+			want: "&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt; &amp; more",
+		},
+		{
+			name: "new lines and carriage returns",
+			in:   "a\r\nb\nc",
+			want: "a<br>b<br>c",
+		},
+		{
+			name: "control characters",
+			in:   "a\x07b\tc\x00",
+			want: "ab\tc",
+		},
+		{
+			name: "foreground color",
+			in:   "\x1b[31mred\x1b[0m plain",
+			want: `<span style="color:#cd3131">red</span> plain`,
+		},
+		{
+			name: "bright colors",
+			in:   "\x1b[92;104mtext",
+			want: `<span style="color:#23d18b;background-color:#3b8eea">text</span>`,
+		},
+		{
+			name: "bold and reset",
+			in:   "\x1b[1mbold\x1b[m normal",
+			want: `<span style="font-weight:bold">bold</span> normal`,
+		},
+		{
+			name: "bold off keeps color",
+			in:   "\x1b[1;32mA\x1b[22mB",
+			want: `<span style="color:#0dbc79;font-weight:bold">A</span><span style="color:#0dbc79">B</span>`,
+		},
+		{
+			name: "default color",
+			in:   "\x1b[34;43mA\x1b[39mB\x1b[49mC",
+			want: `<span style="color:#2472c8;background-color:#e5e510">A</span><span style="background-color:#e5e510">B</span>C`,
+		},
+		{
+			name: "256 colors",
+			in:   "\x1b[38;5;9mA\x1b[38;5;196mB\x1b[48;5;244mC",
+			want: `<span style="color:#f14c4c">A</span><span style="color:#ff0000">B</span><span style="color:#ff0000;background-color:#808080">C</span>`,
+		},
+		{
+			name: "true color",
+			in:   "\x1b[38;2;255;128;0mA\x1b[48:2:1:2:3mB",
+			want: `<span style="color:#ff8000">A</span><span style="color:#ff8000;background-color:#010203">B</span>`,
+		},
+		{
+			name: "invalid extended color",
+			in:   "\x1b[38;5;300mA\x1b[38;2;1mB",
+			want: "AB",
+		},
+		{
+			name: "inverse",
+			in:   "\x1b[7mA",
+			want: `<span style="color:#ffffff;background-color:#000000">A</span>`,
+		},
+		{
+			name: "styles",
+			in:   "\x1b[2;3;4;9mA",
+			want: `<span style="opacity:0.7;font-style:italic;text-decoration:underline line-through">A</span>`,
+		},
+		{
+			name: "empty styled text",
+			in:   "\x1b[31m\x1b[0mA",
+			want: "A",
+		},
+		{
+			name: "strip other csi sequences",
+			in:   "\x1b[2K\x1b[1GA\x1b[?25lB\x1b[3;4HC",
+			want: "ABC",
+		},
+		{
+			name: "strip osc sequences",
+			in:   "\x1b]0;title\x07A\x1b]8;;http://example.com\x1b\\B",
+			want: "AB",
+		},
+		{
+			name: "strip two-byte sequences",
+			in:   "\x1b7A\x1b8B",
+			want: "AB",
+		},
+		{
+			name: "invalid csi sequence",
+			in:   "\x1b[\x01A",
+			want: "A",
+		},
+		{
+			name: "utf-8",
+			in:   "\x1b[1mñandú ✓\x1b[0m",
+			want: `<span style="font-weight:bold">ñandú ✓</span>`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ToHTML([]byte(tt.in)); got != tt.want {
+				t.Errorf("ToHTML(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConverterChunks(t *testing.T) {
+	tests := []struct {
+		name   string
+		chunks []string
+		want   []string
+	}{
+		{
+			name:   "style kept between chunks",
+			chunks: []string{"\x1b[31mA", "B\x1b[0m", "C"},
+			want:   []string{`<span style="color:#cd3131">A</span>`, `<span style="color:#cd3131">B</span>`, "C"},
+		},
+		{
+			name:   "split csi sequence",
+			chunks: []string{"A\x1b", "[3", "2mB"},
+			want:   []string{"A", "", `<span style="color:#0dbc79">B</span>`},
+		},
+		{
+			name:   "split osc sequence",
+			chunks: []string{"A\x1b]0;ti", "tle\x1b", "\\B"},
+			want:   []string{"A", "", "B"},
+		},
+		{
+			name:   "split rune",
+			chunks: []string{"a\xc3", "\xb1b\xe2\x9c", "\x93"},
+			want:   []string{"a", "ñb", "✓"},
+		},
+		{
+			name:   "split rune after sequence",
+			chunks: []string{"\x1b[1m\xf0\x9f", "\x98\x80"},
+			want:   []string{"", `<span style="font-weight:bold">😀</span>`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Converter
+			for i, chunk := range tt.chunks {
+				if got := c.Convert([]byte(chunk)); got != tt.want[i] {
+					t.Errorf("Convert(%q) = %q, want %q", chunk, got, tt.want[i])
+				}
+			}
+			if got := c.Flush(); got != "" {
+				t.Errorf("Flush() = %q, want empty", got)
+			}
+		})
+	}
+}
+
+func TestConverterFlush(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		convert string
+		flush   string
+	}{
+		{
+			name:    "incomplete rune",
+			in:      "a\xc3",
+			convert: "a",
+			flush:   "�",
+		},
+		{
+			name:    "incomplete sequence",
+			in:      "\x1b[31mA\x1b[1",
+			convert: `<span style="color:#cd3131">A</span>`,
+			flush:   `<span style="color:#cd3131">[1</span>`,
+		},
+		{
+			name:    "nothing pending",
+			in:      "A",
+			convert: "A",
+			flush:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var c Converter
+			if got := c.Convert([]byte(tt.in)); got != tt.convert {
+				t.Errorf("Convert(%q) = %q, want %q", tt.in, got, tt.convert)
+			}
+			if got := c.Flush(); got != tt.flush {
+				t.Errorf("Flush() = %q, want %q", got, tt.flush)
+			}
+			// The converter is reset after flushing
+			if got := c.Convert([]byte("B")); got != "B" {
+				t.Errorf("Convert after Flush = %q, want %q", got, "B")
+			}
+		})
+	}
+}
+
+func TestConverterLongSequence(t *testing.T) {
+	// Incomplete sequences too long to be valid aren't kept waiting for the
+	// rest, their introducer is dropped
+	var c Converter
+	params := strings.Repeat("1;", maxPending)
+	if got, want := c.Convert([]byte("\x1b["+params)), "["+params; got != want {
+		t.Errorf("Convert(long sequence) = %q, want %q", got, want)
+	}
+	if got := c.Flush(); got != "" {
+		t.Errorf("Flush() = %q, want empty", got)
+	}
+}
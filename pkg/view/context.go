@@ -0,0 +1,31 @@
+package view
+
+import "context"
+
+type userKey struct{}
+
+// WithUser returns a context with the name of the authenticated user, which is
+// shown in the navigation bar.
+func WithUser(ctx context.Context, user string) context.Context {
+	return context.WithValue(ctx, userKey{}, user)
+}
+
+// UserFromContext returns the name of the authenticated user, or an empty
+// string if there is none.
+func UserFromContext(ctx context.Context) string {
+	user, _ := ctx.Value(userKey{}).(string)
+	return user
+}
+
+type auditKey struct{}
+
+// WithAudit returns a context that shows the link to the audit log in the
+// navigation bar.
+func WithAudit(ctx context.Context) context.Context {
+	return context.WithValue(ctx, auditKey{}, true)
+}
+
+func auditEnabled(ctx context.Context) bool {
+	enabled, _ := ctx.Value(auditKey{}).(bool)
+	return enabled
+}
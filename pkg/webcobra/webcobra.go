@@ -1,11 +1,77 @@
 package webcobra
 
 import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
 	"github.com/igolaizola/webcli"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 )
 
+// SecretAnnotation is the flag annotation that marks secret flags.
+// Secret flags are shown as password inputs and their values are redacted and
+// never written to the config files.
+const SecretAnnotation = "webcli_secret"
+
+// MarkFlagSecret marks a flag of the flag set as secret.
+func MarkFlagSecret(flags *pflag.FlagSet, name string) error {
+	return flags.SetAnnotation(name, SecretAnnotation, []string{"true"})
+}
+
+// UploadAnnotation is the flag annotation that marks upload flags.
+// Upload flags are shown as file inputs and receive the path where the
+// uploaded file is stored during the run.
+const UploadAnnotation = "webcli_upload"
+
+// MarkFlagUpload marks a flag of the flag set as an upload.
+func MarkFlagUpload(flags *pflag.FlagSet, name string) error {
+	return flags.SetAnnotation(name, UploadAnnotation, []string{"true"})
+}
+
+// TypeAnnotation is the flag annotation with the type of string flags that
+// hold values pflag has no type for: "size", "date" or "time".
+const TypeAnnotation = "webcli_type"
+
+// MarkFlagSize marks a string flag of the flag set as a byte size, e.g.
+// "10MB", which is entered as an amount and a unit.
+func MarkFlagSize(flags *pflag.FlagSet, name string) error {
+	return flags.SetAnnotation(name, TypeAnnotation, []string{"size"})
+}
+
+// MarkFlagDate marks a string flag of the flag set as a date formatted as
+// YYYY-MM-DD, which is entered with a date picker.
+func MarkFlagDate(flags *pflag.FlagSet, name string) error {
+	return flags.SetAnnotation(name, TypeAnnotation, []string{"date"})
+}
+
+// MarkFlagTime marks a string flag of the flag set as a time formatted as
+// RFC3339, which is entered with a date and time picker.
+func MarkFlagTime(flags *pflag.FlagSet, name string) error {
+	return flags.SetAnnotation(name, TypeAnnotation, []string{"time"})
+}
+
+// GracePeriodAnnotation is the command annotation with the time given to the
+// command to exit after being canceled, before it is killed, e.g. "30s".
+const GracePeriodAnnotation = "webcli_grace_period"
+
+// SetGracePeriod sets the time given to the command to exit after being
+// canceled, before it is killed.
+func SetGracePeriod(cmd *cobra.Command, d time.Duration) {
+	if cmd.Annotations == nil {
+		cmd.Annotations = map[string]string{}
+	}
+	cmd.Annotations[GracePeriodAnnotation] = d.String()
+}
+
 func Parse(cmds []*cobra.Command) []*webcli.Command {
 	var wcmds []*webcli.Command
 	for _, cmd := range cmds {
@@ -22,15 +88,25 @@ func toCommand(c *cobra.Command) *webcli.Command {
 	for _, sub := range c.Commands() {
 		subs = append(subs, toCommand(sub))
 	}
+	// Invalid grace periods are ignored and the default one is used
+	grace, _ := time.ParseDuration(c.Annotations[GracePeriodAnnotation])
+	args := webcli.ParseUsage(c.Use)
+	options, suggestions := toArgOptions(c)
+	for _, a := range args {
+		a.Options = options
+		a.Suggestions = suggestions
+	}
 	return &webcli.Command{
-		Fields:      toFields(c.Flags(), c.LocalFlags(), c.PersistentFlags()),
+		Fields:      toFields(c, c.Flags(), c.LocalFlags(), c.PersistentFlags()),
 		Name:        c.Name(),
 		Description: c.Short + "\n" + c.Long,
 		Subcommands: subs,
+		Args:        args,
+		GracePeriod: grace,
 	}
 }
 
-func toFields(fss ...*pflag.FlagSet) []*webcli.Field {
+func toFields(c *cobra.Command, fss ...*pflag.FlagSet) []*webcli.Field {
 	var fields []*webcli.Field
 	lookup := map[string]string{}
 	for _, fs := range fss {
@@ -43,13 +119,47 @@ func toFields(fss ...*pflag.FlagSet) []*webcli.Field {
 			}
 			typ, arr := toType(f)
 			lookup[f.Name] = f.Name
-			fields = append(fields, &webcli.Field{
+			field := &webcli.Field{
 				Name:        f.Name,
 				Default:     f.Value.String(),
 				Description: f.Usage,
 				Type:        typ,
 				Array:       arr,
-			})
+			}
+			if _, ok := f.Annotations[SecretAnnotation]; ok {
+				field.Secret = true
+			}
+			if _, ok := f.Annotations[cobra.BashCompOneRequiredFlag]; ok {
+				field.Required = true
+			}
+			if t := f.Value.Type(); t == "ip" || t == "ipSlice" {
+				field.Validate = validateIP
+			}
+			// Paths marked with MarkFlagFilename or MarkFlagDirname
+			if exts, ok := f.Annotations[cobra.BashCompFilenameExt]; ok && typ == webcli.Text {
+				field.Type = webcli.File
+				field.Extensions = exts
+			}
+			if _, ok := f.Annotations[cobra.BashCompSubdirsInDir]; ok && typ == webcli.Text {
+				field.Type = webcli.Directory
+			}
+			if _, ok := f.Annotations[UploadAnnotation]; ok && typ == webcli.Text {
+				field.Type = webcli.Upload
+			}
+			if v := f.Annotations[TypeAnnotation]; len(v) > 0 && typ == webcli.Text {
+				switch v[0] {
+				case "size":
+					field.Type = webcli.Size
+				case "date":
+					field.Type = webcli.Date
+				case "time":
+					field.Type = webcli.Time
+				}
+			}
+			if field.Type == webcli.Text {
+				field.Suggestions = toSuggestions(c, f)
+			}
+			fields = append(fields, field)
 		})
 	}
 	return fields
@@ -61,18 +171,184 @@ func toType(f *pflag.Flag) (webcli.FieldType, bool) {
 	case "bool":
 		return webcli.Boolean, false
 	case "duration":
-		return webcli.Text, false
-	case "float64", "int", "int64", "uint", "uint64":
+		return webcli.Duration, false
+	case "boolSlice":
+		return webcli.Boolean, true
+	case "durationSlice":
+		return webcli.Duration, true
+	case "float32", "float64", "int", "int8", "int16", "int32", "int64", "uint", "uint8", "uint16", "uint32", "uint64", "count":
 		return webcli.Number, false
+	case "float32Slice", "float64Slice", "intSlice", "int32Slice", "int64Slice", "uintSlice":
+		return webcli.Number, true
 	case "string":
 		return webcli.Text, false
-	case "stringArray":
+	case "stringArray", "stringSlice", "ipSlice":
 		return webcli.Text, true
+	case "stringToString", "stringToInt", "stringToInt64":
+		// pflag merges the pairs of repeated flags
+		return webcli.Map, true
 	default:
 		return webcli.Text, false
 	}
 }
 
+func validateIP(s string) error {
+	if net.ParseIP(s) == nil {
+		return fmt.Errorf("invalid IP address %q", s)
+	}
+	return nil
+}
+
+// toSuggestions returns a function with the values suggested by the
+// completion function of the flag, registered with cobra's
+// RegisterFlagCompletionFunc. Completions aren't enforced by cobra, so they
+// are only offered while typing, and obtained each time the form is shown.
+func toSuggestions(c *cobra.Command, f *pflag.Flag) func() []string {
+	fn, ok := c.GetFlagCompletionFunc(f.Name)
+	if !ok {
+		return nil
+	}
+	return func() []string {
+		completions, _ := fn(c, nil, "")
+		return completionValues(completions)
+	}
+}
+
+// toArgOptions returns the values accepted by the positional arguments of the
+// command, or a function with the values suggested for them.
+// ValidArgs are only enforced by cobra with OnlyValidArgs, otherwise they are
+// suggested like the values of ValidArgsFunction.
+func toArgOptions(c *cobra.Command) ([]string, func() []string) {
+	if len(c.ValidArgs) > 0 {
+		values := completionValues(c.ValidArgs)
+		if c.Args != nil && reflect.ValueOf(c.Args).Pointer() == reflect.ValueOf(cobra.OnlyValidArgs).Pointer() {
+			return values, nil
+		}
+		return nil, func() []string { return values }
+	}
+	if c.ValidArgsFunction == nil {
+		return nil, nil
+	}
+	fn := c.ValidArgsFunction
+	return nil, func() []string {
+		completions, _ := fn(c, nil, "")
+		return completionValues(completions)
+	}
+}
+
+// completionValues returns the values of cobra completions, removing their
+// descriptions.
+func completionValues(completions []string) []string {
+	var values []string
+	for _, comp := range completions {
+		v, _, _ := strings.Cut(comp, "\t")
+		if v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
 func New(commands []*cobra.Command, opts ...webcli.Option) (*webcli.Server, error) {
 	return webcli.New(Parse(commands), opts...)
 }
+
+// NewExecutor returns an executor that runs the commands in-process, calling
+// the root command directly instead of launching a new process.
+// Output is captured only if the commands write it using cmd.OutOrStdout or
+// cmd.ErrOrStderr.
+// Flag values are shared between executions, so executions are serialized and
+// flags are reset to their defaults before each one. Map flags such as
+// stringToString can't be cleared by pflag, so they keep the entries of
+// previous executions.
+func NewExecutor(root *cobra.Command) webcli.Executor {
+	var lck sync.Mutex
+	return webcli.NewFuncExecutor(func(ctx context.Context, args []string, stdin io.Reader, output io.Writer) error {
+		lck.Lock()
+		defer lck.Unlock()
+		if err := resetFlags(root); err != nil {
+			return err
+		}
+		root.SetArgs(args)
+		root.SetIn(stdin)
+		root.SetOut(output)
+		root.SetErr(output)
+		return root.ExecuteContext(ctx)
+	})
+}
+
+// resetFlags sets the flags of the command and its subcommands back to their
+// defaults, so values from a previous execution aren't reused.
+func resetFlags(c *cobra.Command) error {
+	var err error
+	reset := func(f *pflag.Flag) {
+		if err != nil || !f.Changed {
+			return
+		}
+		f.Changed = false
+		switch sv, ok := f.Value.(pflag.SliceValue); {
+		case strings.HasPrefix(f.Value.Type(), "stringTo"):
+			// Maps can't be cleared, setting them merges the entries
+			return
+		case ok:
+			// Setting a slice appends to its value once it was set, so it
+			// is replaced with the defaults and wrapped to replace them again
+			w, ok := f.Value.(*sliceValue)
+			if !ok {
+				w = &sliceValue{Value: f.Value, SliceValue: sv}
+				f.Value = w
+			}
+			w.reset = true
+			var values []string
+			if values, err = readCSV(strings.Trim(f.DefValue, "[]")); err == nil {
+				err = sv.Replace(values)
+			}
+		default:
+			err = f.Value.Set(f.DefValue)
+		}
+		if err != nil {
+			err = fmt.Errorf("webcobra: couldn't reset flag %s: %w", f.Name, err)
+		}
+	}
+	c.Flags().VisitAll(reset)
+	c.PersistentFlags().VisitAll(reset)
+	if err != nil {
+		return err
+	}
+	for _, sub := range c.Commands() {
+		if err := resetFlags(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sliceValue wraps a slice flag so the first value set after a reset replaces
+// the defaults instead of being appended to them.
+type sliceValue struct {
+	pflag.Value
+	pflag.SliceValue
+	reset bool
+}
+
+// Set replaces the slice if it was reset, otherwise it appends the values.
+func (v *sliceValue) Set(s string) error {
+	if !v.reset {
+		return v.Value.Set(s)
+	}
+	values, err := readCSV(s)
+	if err != nil {
+		return err
+	}
+	v.reset = false
+	return v.Replace(values)
+}
+
+// readCSV splits comma-separated values the same way pflag does.
+func readCSV(s string) ([]string, error) {
+	values, err := csv.NewReader(strings.NewReader(s)).Read()
+	if errors.Is(err, io.EOF) {
+		return nil, nil
+	}
+	return values, err
+}
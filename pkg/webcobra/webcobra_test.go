@@ -0,0 +1,127 @@
+package webcobra
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/igolaizola/webcli"
+	"github.com/spf13/cobra"
+)
+
+// execute runs the arguments with the executor and returns its output.
+func execute(t *testing.T, e webcli.Executor, args ...string) string {
+	t.Helper()
+	exec, err := e.Start(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(exec.Output())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exec.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestExecutorResetsFlags(t *testing.T) {
+	var (
+		verbose bool
+		name    string
+		tags    []string
+	)
+	root := &cobra.Command{Use: "app", SilenceUsage: true}
+	root.PersistentFlags().BoolVar(&verbose, "verbose", false, "verbose output")
+	greet := &cobra.Command{
+		Use: "greet",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Fprintf(cmd.OutOrStdout(), "%s %v %v %v\n", name, tags, verbose, cmd.Flags().Changed("name"))
+			return nil
+		},
+	}
+	greet.Flags().StringVar(&name, "name", "world", "name to greet")
+	greet.Flags().StringSliceVar(&tags, "tags", []string{"a"}, "tags")
+	root.AddCommand(greet)
+	e := NewExecutor(root)
+
+	// The second execution omits the flags set by the first one
+	runs := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"greet", "--name=gopher", "--tags=b,c", "--verbose"}, "gopher [b c] true true\n"},
+		{[]string{"greet"}, "world [a] false false\n"},
+		{[]string{"greet", "--tags=d"}, "world [d] false false\n"},
+	}
+	for _, r := range runs {
+		if got := execute(t, e, r.args...); got != r.want {
+			t.Errorf("execute(%q) = %q, want %q", r.args, got, r.want)
+		}
+	}
+}
+
+func TestParseCompletions(t *testing.T) {
+	var calls int
+	dynamic := func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		calls++
+		return []string{fmt.Sprintf("v%d\tversion", calls)}, cobra.ShellCompDirectiveNoFileComp
+	}
+	tests := []struct {
+		name        string
+		cmd         *cobra.Command
+		options     []string
+		suggestions []string
+	}{
+		{
+			name:    "enforced valid args",
+			cmd:     &cobra.Command{Use: "deploy <env>", ValidArgs: []string{"dev", "prod\tProduction"}, Args: cobra.OnlyValidArgs},
+			options: []string{"dev", "prod"},
+		},
+		{
+			name:        "suggested valid args",
+			cmd:         &cobra.Command{Use: "deploy <env>", ValidArgs: []string{"dev", "prod\tProduction"}},
+			suggestions: []string{"dev", "prod"},
+		},
+		{
+			name:        "valid args function",
+			cmd:         &cobra.Command{Use: "deploy <env>", ValidArgsFunction: dynamic},
+			suggestions: []string{"v1"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls = 0
+			arg := Parse([]*cobra.Command{tt.cmd})[0].Args[0]
+			if fmt.Sprint(arg.Options) != fmt.Sprint(tt.options) {
+				t.Errorf("Options = %q, want %q", arg.Options, tt.options)
+			}
+			var got []string
+			if arg.Suggestions != nil {
+				got = arg.Suggestions()
+			}
+			if fmt.Sprint(got) != fmt.Sprint(tt.suggestions) {
+				t.Errorf("Suggestions() = %q, want %q", got, tt.suggestions)
+			}
+		})
+	}
+
+	// Flag completions are suggested and obtained again each time
+	calls = 0
+	cmd := &cobra.Command{Use: "deploy"}
+	cmd.Flags().String("version", "", "version to deploy")
+	if err := cmd.RegisterFlagCompletionFunc("version", dynamic); err != nil {
+		t.Fatal(err)
+	}
+	field := Parse([]*cobra.Command{cmd})[0].Fields[0]
+	if field.Type != webcli.Text || field.Suggestions == nil {
+		t.Fatalf("field = %v with suggestions %v, want text field with suggestions", field.Type, field.Suggestions != nil)
+	}
+	for _, want := range []string{"v1", "v2"} {
+		if got := field.Suggestions(); fmt.Sprint(got) != fmt.Sprint([]string{want}) {
+			t.Errorf("Suggestions() = %q, want [%s]", got, want)
+		}
+	}
+}
@@ -1,10 +1,17 @@
 package webff
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/igolaizola/webcli"
+	"github.com/peterbourgon/ff/v3"
 	"github.com/peterbourgon/ff/v3/ffcli"
 )
 
@@ -26,6 +33,7 @@ func toCommand(c *ffcli.Command) *webcli.Command {
 		Name:        c.Name,
 		Description: c.ShortHelp + "\n" + c.LongHelp,
 		Subcommands: subs,
+		Args:        webcli.ParseUsage(c.ShortUsage),
 	}
 }
 
@@ -35,23 +43,127 @@ func toFields(fs *flag.FlagSet) []*webcli.Field {
 		return fields
 	}
 	fs.VisitAll(func(f *flag.Flag) {
-		fields = append(fields, &webcli.Field{
+		field := &webcli.Field{
 			Name:        f.Name,
 			Default:     f.Value.String(),
 			Description: f.Usage,
 			Type:        toType(f),
-		})
+		}
+		if v, ok := f.Value.(EnumValue); ok {
+			field.Type = webcli.Enum
+			field.Options = v.Options()
+		}
+		if v, ok := f.Value.(*pathValue); ok {
+			field.Type = webcli.File
+			if v.dir {
+				field.Type = webcli.Directory
+			}
+			field.Extensions = v.extensions
+		}
+		if _, ok := f.Value.(*uploadValue); ok {
+			field.Type = webcli.Upload
+		}
+		if v, ok := f.Value.(*typedValue); ok {
+			field.Type = v.typ
+		}
+		// Map values are passed as repeated flags, one per pair, so Set
+		// only needs to parse a single "key=value"
+		if field.Type == webcli.Map {
+			field.Array = true
+		}
+		fields = append(fields, field)
 	})
 	return fields
 }
 
+// EnumValue is a flag value that only accepts some options.
+// Flags with these values are shown as a select field.
+type EnumValue interface {
+	flag.Value
+	Options() []string
+}
+
+// pathValue wraps the value of a flag marked as a path.
+type pathValue struct {
+	flag.Value
+	dir        bool
+	extensions []string
+}
+
+// MarkFlagFilename marks a flag of the flag set as a path to a file, which is
+// shown with a file browser. Only files with the given extensions are shown,
+// if any.
+func MarkFlagFilename(fs *flag.FlagSet, name string, extensions ...string) error {
+	return markPath(fs, name, false, extensions)
+}
+
+// MarkFlagDirname marks a flag of the flag set as a path to a directory, which
+// is shown with a directory browser.
+func MarkFlagDirname(fs *flag.FlagSet, name string) error {
+	return markPath(fs, name, true, nil)
+}
+
+func markPath(fs *flag.FlagSet, name string, dir bool, extensions []string) error {
+	f := fs.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("webff: flag %q does not exist", name)
+	}
+	f.Value = &pathValue{Value: f.Value, dir: dir, extensions: extensions}
+	return nil
+}
+
+// uploadValue wraps the value of a flag marked as an upload.
+type uploadValue struct {
+	flag.Value
+}
+
+// MarkFlagUpload marks a flag of the flag set as an upload, which is shown as
+// a file input and receives the path where the uploaded file is stored during
+// the run.
+func MarkFlagUpload(fs *flag.FlagSet, name string) error {
+	f := fs.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("webff: flag %q does not exist", name)
+	}
+	f.Value = &uploadValue{Value: f.Value}
+	return nil
+}
+
+// typedValue wraps the value of a string flag marked with a type the flag
+// package has no value for.
+type typedValue struct {
+	flag.Value
+	typ webcli.FieldType
+}
+
+// MarkFlagSize marks a flag of the flag set as a byte size, e.g. "10MB", which
+// is entered as an amount and a unit.
+func MarkFlagSize(fs *flag.FlagSet, name string) error {
+	return markType(fs, name, webcli.Size)
+}
+
+// MarkFlagDate marks a flag of the flag set as a date formatted as
+// YYYY-MM-DD, which is entered with a date picker.
+func MarkFlagDate(fs *flag.FlagSet, name string) error {
+	return markType(fs, name, webcli.Date)
+}
+
+func markType(fs *flag.FlagSet, name string, typ webcli.FieldType) error {
+	f := fs.Lookup(name)
+	if f == nil {
+		return fmt.Errorf("webff: flag %q does not exist", name)
+	}
+	f.Value = &typedValue{Value: f.Value, typ: typ}
+	return nil
+}
+
 func toType(f *flag.Flag) webcli.FieldType {
 	t := fmt.Sprintf("%T", f.Value)
 	switch t {
 	case "*flag.boolValue":
 		return webcli.Boolean
 	case "*flag.durationValue":
-		return webcli.Text
+		return webcli.Duration
 	case "*flag.float64Value":
 		return webcli.Number
 	case "*flag.intValue", "*flag.int64Value":
@@ -60,9 +172,18 @@ func toType(f *flag.Flag) webcli.FieldType {
 		return webcli.Text
 	case "*flag.uintValue", "*flag.uint64Value":
 		return webcli.Number
-	default:
-		return webcli.Text
 	}
+	// Times defined with flag.TextVar
+	if g, ok := f.Value.(flag.Getter); ok {
+		if _, ok := g.Get().(*time.Time); ok {
+			return webcli.Time
+		}
+	}
+	// Custom values based on maps, e.g. map[string]string
+	if reflect.Indirect(reflect.ValueOf(f.Value)).Kind() == reflect.Map {
+		return webcli.Map
+	}
+	return webcli.Text
 }
 
 type Config struct {
@@ -74,3 +195,59 @@ type Config struct {
 func New(commands []*ffcli.Command, opts ...webcli.Option) (*webcli.Server, error) {
 	return webcli.New(Parse(commands), opts...)
 }
+
+// NewExecutor returns an executor that runs the commands in-process, calling
+// their Exec functions directly instead of launching a new process.
+// The commands should be the same ones passed to New.
+// Only the output of the flag sets is captured, anything the commands print
+// to os.Stdout or os.Stderr isn't shown in the web interface.
+// Flag sets should use flag.ContinueOnError, otherwise an invalid value would
+// exit the whole server.
+// Flag values are shared between executions, so executions are serialized.
+func NewExecutor(cmds []*ffcli.Command) webcli.Executor {
+	var lck sync.Mutex
+	return webcli.NewFuncExecutor(func(ctx context.Context, args []string, stdin io.Reader, output io.Writer) error {
+		lck.Lock()
+		defer lck.Unlock()
+
+		// Find the command using the path at the beginning of the arguments,
+		// walking a copy so the next execution starts again from the top
+		list := cmds
+		var cmd *ffcli.Command
+		for len(args) > 0 {
+			sub := findCommand(list, args[0])
+			if sub == nil {
+				break
+			}
+			cmd = sub
+			list = sub.Subcommands
+			args = args[1:]
+		}
+		if cmd == nil {
+			return fmt.Errorf("webff: command not found")
+		}
+		if cmd.Exec == nil {
+			return fmt.Errorf("webff: command %s has no exec function", cmd.Name)
+		}
+
+		// Parse the flags and run the command
+		fs := cmd.FlagSet
+		if fs == nil {
+			fs = flag.NewFlagSet(cmd.Name, flag.ContinueOnError)
+		}
+		fs.SetOutput(output)
+		if err := ff.Parse(fs, args, cmd.Options...); err != nil {
+			return err
+		}
+		return cmd.Exec(ctx, fs.Args())
+	})
+}
+
+func findCommand(cmds []*ffcli.Command, name string) *ffcli.Command {
+	for _, c := range cmds {
+		if strings.EqualFold(c.Name, name) {
+			return c
+		}
+	}
+	return nil
+}
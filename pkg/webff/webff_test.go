@@ -0,0 +1,68 @@
+package webff
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/igolaizola/webcli"
+	"github.com/peterbourgon/ff/v3/ffcli"
+)
+
+// execute runs the arguments with the executor and returns its output.
+func execute(t *testing.T, e webcli.Executor, args ...string) string {
+	t.Helper()
+	exec, err := e.Start(context.Background(), args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := io.ReadAll(exec.Output())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := exec.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+// printCommand returns a command that prints its name to the output of its
+// flag set.
+func printCommand(name string, subcommands ...*ffcli.Command) *ffcli.Command {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	return &ffcli.Command{
+		Name:        name,
+		FlagSet:     fs,
+		Subcommands: subcommands,
+		Exec: func(ctx context.Context, args []string) error {
+			fmt.Fprintln(fs.Output(), name)
+			return nil
+		},
+	}
+}
+
+func TestExecutorSubcommands(t *testing.T) {
+	cmds := []*ffcli.Command{
+		printCommand("db", printCommand("migrate"), printCommand("seed")),
+		printCommand("serve"),
+	}
+	e := NewExecutor(cmds)
+
+	// Each execution looks up its command from the top of the tree
+	runs := []struct {
+		args []string
+		want string
+	}{
+		{[]string{"db", "migrate"}, "migrate\n"},
+		{[]string{"db", "seed"}, "seed\n"},
+		{[]string{"serve"}, "serve\n"},
+		{[]string{"db"}, "db\n"},
+	}
+	for _, r := range runs {
+		if got := execute(t, e, r.args...); got != r.want {
+			t.Errorf("execute(%q) = %q, want %q", r.args, got, r.want)
+		}
+	}
+}
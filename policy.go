@@ -0,0 +1,173 @@
+package webcli
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Action is an action that can be performed on a command.
+type Action string
+
+const (
+	// ActionView allows to see the command, its form and its runs.
+	ActionView Action = "view"
+	// ActionRun allows to launch the command.
+	ActionRun Action = "run"
+	// ActionCancel allows to cancel runs of the command.
+	ActionCancel Action = "cancel"
+	// ActionSave allows to save the config of the command.
+	ActionSave Action = "save"
+)
+
+// Policy defines which users can perform each action on each command.
+//
+// Rules are evaluated in order and the first rule that matches the command
+// and the action decides whether the user is allowed.
+// If no rule matches, the action is allowed unless DefaultDeny is set.
+type Policy struct {
+	// Roles contains the roles of each user.
+	Roles map[string][]string `yaml:"roles" json:"roles"`
+	// Rules are the authorization rules, evaluated in order.
+	Rules []Rule `yaml:"rules" json:"rules"`
+	// DefaultDeny denies the actions that don't match any rule.
+	DefaultDeny bool `yaml:"default_deny" json:"default_deny"`
+}
+
+// Rule allows some roles to perform some actions on the commands that match
+// any of its globs.
+type Rule struct {
+	// Commands are globs matched against command names, e.g. "db/migrate" or
+	// "db/*". A "*" matches a single level of the path, while "**" matches
+	// any number of levels.
+	Commands []string `yaml:"commands" json:"commands"`
+	// Actions are the actions covered by the rule, all of them if empty.
+	Actions []Action `yaml:"actions" json:"actions"`
+	// Roles are the roles allowed to perform the actions. The role "*"
+	// includes any authenticated user.
+	Roles []string `yaml:"roles" json:"roles"`
+}
+
+// LoadPolicy reads a policy from a YAML file.
+//
+//	roles:
+//	  alice: [admin]
+//	  bob: [dev]
+//	rules:
+//	  - commands: ["db/**"]
+//	    roles: [admin]
+//	  - commands: ["**"]
+//	    actions: [view, run]
+//	    roles: ["*"]
+//	default_deny: true
+func LoadPolicy(path string) (*Policy, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("webcli: couldn't read policy file: %w", err)
+	}
+	var p Policy
+	if err := yaml.Unmarshal(b, &p); err != nil {
+		return nil, fmt.Errorf("webcli: couldn't parse policy file %s: %w", path, err)
+	}
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+func (p *Policy) validate() error {
+	for i, rule := range p.Rules {
+		for _, glob := range rule.Commands {
+			if _, err := path.Match(glob, ""); err != nil {
+				return fmt.Errorf("webcli: invalid glob %q in rule %d: %w", glob, i, err)
+			}
+		}
+		for _, a := range rule.Actions {
+			switch a {
+			case ActionView, ActionRun, ActionCancel, ActionSave:
+			default:
+				return fmt.Errorf("webcli: invalid action %q in rule %d", a, i)
+			}
+		}
+	}
+	return nil
+}
+
+// Allowed reports whether the user can perform the action on the command.
+// The user is empty when the request isn't authenticated.
+func (p *Policy) Allowed(user, command string, action Action) bool {
+	for _, rule := range p.Rules {
+		if !rule.matches(command, action) {
+			continue
+		}
+		for _, role := range rule.Roles {
+			if role == "*" && user != "" {
+				return true
+			}
+			for _, userRole := range p.Roles[user] {
+				if role == userRole {
+					return true
+				}
+			}
+		}
+		return false
+	}
+	return !p.DefaultDeny
+}
+
+func (r *Rule) matches(command string, action Action) bool {
+	if len(r.Actions) > 0 {
+		var found bool
+		for _, a := range r.Actions {
+			if a == action {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for _, glob := range r.Commands {
+		if matchGlob(strings.Split(glob, "/"), strings.Split(command, "/")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchGlob matches the levels of a command name against the levels of a
+// glob, where "**" matches any number of levels.
+func matchGlob(glob, name []string) bool {
+	if len(glob) == 0 {
+		return len(name) == 0
+	}
+	if glob[0] == "**" {
+		for i := 0; i <= len(name); i++ {
+			if matchGlob(glob[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(glob[0], name[0]); !ok {
+		return false
+	}
+	return matchGlob(glob[1:], name[1:])
+}
+
+// allowed reports whether the user of the request can perform the action on
+// the command.
+func (o *options) allowed(r *http.Request, command string, action Action) bool {
+	if o.policy == nil {
+		return true
+	}
+	return o.policy.Allowed(UserFromContext(r.Context()), command, action)
+}
@@ -0,0 +1,82 @@
+package webcli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		glob string
+		name string
+		want bool
+	}{
+		{"db/migrate", "db/migrate", true},
+		{"db/migrate", "db/seed", false},
+		{"*", "serve", true},
+		{"*", "db/migrate", false},
+		{"db/*", "db/migrate", true},
+		{"db/*", "db", false},
+		{"db/*", "db/migrate/up", false},
+		{"*/migrate", "db/migrate", true},
+		{"db/mi?rate", "db/migrate", true},
+		{"db/?", "db/migrate", false},
+		{"db/??", "db/up", true},
+		{"**", "serve", true},
+		{"**", "db/migrate/up", true},
+		{"db/**", "db", true},
+		{"db/**", "db/migrate/up", true},
+		{"db/**", "dbx/migrate", false},
+		{"**/up", "db/migrate/up", true},
+		{"**/up", "db/migrate/down", false},
+		{"db/**/up", "db/up", true},
+		{"db/**/up", "db/migrate/v2/up", true},
+	}
+	for _, tt := range tests {
+		got := matchGlob(strings.Split(tt.glob, "/"), strings.Split(tt.name, "/"))
+		if got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.glob, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyAllowed(t *testing.T) {
+	p := &Policy{
+		Roles: map[string][]string{
+			"alice": {"admin"},
+			"bob":   {"dev"},
+		},
+		Rules: []Rule{
+			// Earlier rules deny what later rules would allow
+			{Commands: []string{"db/**"}, Roles: []string{"admin"}},
+			{Commands: []string{"**"}, Actions: []Action{ActionView, ActionRun}, Roles: []string{"*"}},
+		},
+		DefaultDeny: true,
+	}
+	tests := []struct {
+		user    string
+		command string
+		action  Action
+		want    bool
+	}{
+		{"alice", "db/migrate", ActionRun, true},
+		{"alice", "db/migrate", ActionCancel, true},
+		{"bob", "db/migrate", ActionView, false},
+		{"bob", "db/migrate", ActionRun, false},
+		{"bob", "serve", ActionRun, true},
+		{"bob", "serve", ActionCancel, false},
+		{"alice", "serve", ActionCancel, false},
+		{"", "serve", ActionView, false},
+	}
+	for _, tt := range tests {
+		if got := p.Allowed(tt.user, tt.command, tt.action); got != tt.want {
+			t.Errorf("Allowed(%q, %q, %s) = %v, want %v", tt.user, tt.command, tt.action, got, tt.want)
+		}
+	}
+
+	// Actions that don't match any rule are allowed by default
+	p.DefaultDeny = false
+	if !p.Allowed("bob", "serve", ActionCancel) {
+		t.Errorf("Allowed(bob, serve, cancel) = false without default deny, want true")
+	}
+}
@@ -0,0 +1,17 @@
+//go:build !unix
+
+package webcli
+
+import (
+	"os"
+	"os/exec"
+)
+
+// setProcessGroup does nothing on systems without process groups.
+func setProcessGroup(cmd *exec.Cmd) {}
+
+// signalGroup sends a signal to a started command. Processes it spawned
+// don't receive it on systems without process groups.
+func signalGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Signal(sig)
+}
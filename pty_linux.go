@@ -0,0 +1,226 @@
+//go:build linux
+
+package webcli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// NewPTYExecutor returns an executor that runs the given binary attached to a
+// pseudo-terminal, with the prefix arguments followed by the command
+// arguments. If name is empty, another instance of the current executable is
+// started.
+// Its output is shown in a terminal emulator in the browser instead of the
+// log, so progress bars, spinners and interactive prompts are displayed as in
+// a real terminal.
+// It is only supported on Linux.
+func NewPTYExecutor(name string, prefix ...string) Executor {
+	return ExecutorFunc(func(ctx context.Context, args []string) (Execution, error) {
+		path := name
+		if path == "" {
+			exePath, err := os.Executable()
+			if err != nil {
+				return nil, fmt.Errorf("error getting executable path: %w", err)
+			}
+			path = exePath
+		}
+		all := append(append([]string{}, prefix...), args...)
+		return launchPTY(ctx, path, all)
+	})
+}
+
+// Default window size of the terminal, until the browser sends its own.
+const (
+	defaultTerminalCols = 80
+	defaultTerminalRows = 24
+)
+
+// ptyDrainTimeout is the time without output that ends the output of the
+// terminal once the command exits. Processes started by the command may keep
+// the terminal open, so its output wouldn't end otherwise.
+const ptyDrainTimeout = 200 * time.Millisecond
+
+type ptyExecution struct {
+	cmd     *exec.Cmd
+	master  *os.File
+	exited  chan struct{}
+	waitErr error
+}
+
+func (e *ptyExecution) Output() io.Reader     { return &ptyReader{master: e.master, exited: e.exited} }
+func (e *ptyExecution) Stdin() io.WriteCloser { return &ptyWriter{master: e.master} }
+
+// wait waits for the command to exit and stops a pending read once the
+// output left has been read.
+func (e *ptyExecution) wait() {
+	e.waitErr = e.cmd.Wait()
+	close(e.exited)
+	_ = e.master.SetReadDeadline(time.Now().Add(ptyDrainTimeout))
+}
+
+func (e *ptyExecution) Wait() (ExitStatus, error) {
+	<-e.exited
+	_ = e.master.Close()
+	err := e.waitErr
+	var exitErr *exec.ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return ExitStatus{Code: -1}, err
+	}
+	return processExitStatus(e.cmd.ProcessState), nil
+}
+
+func (e *ptyExecution) Signal(sig os.Signal) error {
+	return signalGroup(e.cmd, sig)
+}
+
+func (e *ptyExecution) Resize(cols, rows int) error {
+	if cols <= 0 || rows <= 0 || cols > 0xffff || rows > 0xffff {
+		return fmt.Errorf("webcli: invalid terminal size %dx%d", cols, rows)
+	}
+	return setWindowSize(e.master, cols, rows)
+}
+
+// ptyReader reads the output of the terminal. Linux returns EIO once all
+// the processes attached to the terminal have exited, and reads time out
+// once the command has exited and its output has been drained, both are
+// reported as the end of the output.
+type ptyReader struct {
+	master *os.File
+	exited <-chan struct{}
+}
+
+func (r *ptyReader) Read(p []byte) (int, error) {
+	select {
+	case <-r.exited:
+		_ = r.master.SetReadDeadline(time.Now().Add(ptyDrainTimeout))
+	default:
+	}
+	n, err := r.master.Read(p)
+	if errors.Is(err, syscall.EIO) || errors.Is(err, os.ErrDeadlineExceeded) {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// ptyWriter writes to the input of the terminal. Closing it sends the
+// end-of-file character instead of closing the terminal, which is still used
+// to read the output.
+type ptyWriter struct {
+	master *os.File
+}
+
+func (w *ptyWriter) Write(p []byte) (int, error) {
+	return w.master.Write(p)
+}
+
+func (w *ptyWriter) Close() error {
+	_, err := w.master.Write([]byte{0x04})
+	return err
+}
+
+// launchPTY starts the binary with the provided arguments in a new session
+// whose controlling terminal is a new pseudo-terminal.
+func launchPTY(ctx context.Context, name string, args []string) (*ptyExecution, error) {
+	master, tty, err := openPTY()
+	if err != nil {
+		return nil, err
+	}
+	if err := setWindowSize(master, defaultTerminalCols, defaultTerminalRows); err != nil {
+		_ = master.Close()
+		_ = tty.Close()
+		return nil, err
+	}
+
+	cmd := exec.CommandContext(ctx, name, args...)
+	cmd.Stdin = tty
+	cmd.Stdout = tty
+	cmd.Stderr = tty
+	cmd.Env = append(os.Environ(), "TERM=xterm-256color")
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid:  true,
+		Setctty: true,
+		Ctty:    0,
+	}
+	// The new session is also a new process group, which is killed when the
+	// context is done
+	cmd.Cancel = func() error {
+		return signalGroup(cmd, os.Kill)
+	}
+
+	// The terminal is only kept open by the command once started
+	err = cmd.Start()
+	_ = tty.Close()
+	if err != nil {
+		_ = master.Close()
+		return nil, fmt.Errorf("error starting command: %w", err)
+	}
+	e := &ptyExecution{
+		cmd:    cmd,
+		master: master,
+		exited: make(chan struct{}),
+	}
+	go e.wait()
+	return e, nil
+}
+
+// openPTY opens a new pseudo-terminal and returns both of its ends.
+func openPTY() (master, tty *os.File, err error) {
+	master, err = os.OpenFile("/dev/ptmx", os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		return nil, nil, fmt.Errorf("webcli: couldn't open pty: %w", err)
+	}
+	var unlock int32
+	if err := ioctl(master, syscall.TIOCSPTLCK, unsafe.Pointer(&unlock)); err != nil {
+		_ = master.Close()
+		return nil, nil, fmt.Errorf("webcli: couldn't unlock pty: %w", err)
+	}
+	var n uint32
+	if err := ioctl(master, syscall.TIOCGPTN, unsafe.Pointer(&n)); err != nil {
+		_ = master.Close()
+		return nil, nil, fmt.Errorf("webcli: couldn't get pty number: %w", err)
+	}
+	tty, err = os.OpenFile(fmt.Sprintf("/dev/pts/%d", n), os.O_RDWR|syscall.O_NOCTTY, 0)
+	if err != nil {
+		_ = master.Close()
+		return nil, nil, fmt.Errorf("webcli: couldn't open tty: %w", err)
+	}
+	return master, tty, nil
+}
+
+// setWindowSize sets the window size of the terminal.
+func setWindowSize(f *os.File, cols, rows int) error {
+	ws := struct {
+		Row, Col, X, Y uint16
+	}{Row: uint16(rows), Col: uint16(cols)}
+	if err := ioctl(f, syscall.TIOCSWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return fmt.Errorf("webcli: couldn't set terminal size: %w", err)
+	}
+	return nil
+}
+
+// ioctl runs an ioctl request on the file without switching it to blocking
+// mode, as calling Fd would do.
+func ioctl(f *os.File, req uint, arg unsafe.Pointer) error {
+	conn, err := f.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var errno syscall.Errno
+	if err := conn.Control(func(fd uintptr) {
+		_, _, errno = syscall.Syscall(syscall.SYS_IOCTL, fd, uintptr(req), uintptr(arg))
+	}); err != nil {
+		return err
+	}
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
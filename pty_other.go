@@ -0,0 +1,17 @@
+//go:build !linux
+
+package webcli
+
+import (
+	"context"
+	"errors"
+)
+
+// NewPTYExecutor returns an executor that runs the given binary attached to a
+// pseudo-terminal.
+// It is only supported on Linux, on other systems starting a command fails.
+func NewPTYExecutor(name string, prefix ...string) Executor {
+	return ExecutorFunc(func(ctx context.Context, args []string) (Execution, error) {
+		return nil, errors.New("webcli: PTY executor is only supported on Linux")
+	})
+}
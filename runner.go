@@ -0,0 +1,115 @@
+package webcli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// runner keeps track of the processes launched from the web interface and
+// the API while they are running.
+type runner struct {
+	ctx       context.Context
+	o         *options
+	cmds      map[string]*parsedCommand
+	lck       sync.Mutex
+	processes map[string]*process
+}
+
+func newRunner(ctx context.Context, o *options, cmds map[string]*parsedCommand) *runner {
+	return &runner{
+		ctx:       ctx,
+		o:         o,
+		cmds:      cmds,
+		processes: map[string]*process{},
+	}
+}
+
+// start launches a new process with the given command name and flags.
+// The effective arguments also include the default values of the flags that
+// aren't passed.
+func (r *runner) start(args, effective []string) (string, *process, error) {
+	r.lck.Lock()
+	defer r.lck.Unlock()
+
+	// Generate an ID from the current time, avoiding collisions with
+	// runs launched at the same millisecond, which may have already ended
+	taken := func(id string) bool {
+		if _, ok := r.processes[id]; ok {
+			return true
+		}
+		_, err := r.o.runStore.Get(id)
+		return err == nil
+	}
+	base := strings.Replace(time.Now().Format("20060102-150405.999"), ".", "-", 1)
+	id := base
+	for i := 2; taken(id); i++ {
+		id = fmt.Sprintf("%s-%d", base, i)
+	}
+
+	// Values of secret fields aren't shown to users, and commands can
+	// override the default grace period
+	redacted := args
+	gracePeriod := r.o.gracePeriod
+	if len(args) > 0 {
+		if cmd, ok := r.cmds[args[0]]; ok {
+			redacted = cmd.redact(args)
+			effective = cmd.redact(effective)
+			if cmd.GracePeriod != 0 {
+				gracePeriod = cmd.GracePeriod
+			}
+		}
+	}
+
+	proc, err := newProcess(r.ctx, id, args, redacted, effective, gracePeriod, r.o)
+	if err != nil {
+		return "", nil, err
+	}
+	r.processes[id] = proc
+
+	// Once the process ends its run is served from the store, so it isn't
+	// kept in memory
+	go func() {
+		<-proc.Done()
+		r.lck.Lock()
+		defer r.lck.Unlock()
+		delete(r.processes, id)
+	}()
+	return id, proc, nil
+}
+
+// process returns the live process with the given ID.
+func (r *runner) process(id string) (*process, bool) {
+	r.lck.Lock()
+	defer r.lck.Unlock()
+	proc, ok := r.processes[id]
+	return proc, ok
+}
+
+// get returns the run with the given ID, using the live state if the process
+// was launched by this server.
+func (r *runner) get(id string) (*Run, error) {
+	if proc, ok := r.process(id); ok {
+		return proc.Run(), nil
+	}
+	return r.o.runStore.Get(id)
+}
+
+// list returns all the runs, from newest to oldest, using the live state of
+// the processes launched by this server.
+func (r *runner) list() ([]*Run, error) {
+	runs, err := r.o.runStore.List()
+	if err != nil {
+		return nil, err
+	}
+	r.lck.Lock()
+	defer r.lck.Unlock()
+	for i, run := range runs {
+		if proc, ok := r.processes[run.ID]; ok {
+			runs[i] = proc.Run()
+		}
+	}
+	return runs, nil
+}
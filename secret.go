@@ -0,0 +1,97 @@
+package webcli
+
+import (
+	"log"
+	"strings"
+	"sync"
+)
+
+// redacted replaces the values of secret fields.
+const redacted = "***"
+
+// SecretStore saves the values of secret fields, which are never written to
+// the config files.
+type SecretStore interface {
+	// Secret returns the saved value of a secret field, or an empty string if
+	// there is none.
+	Secret(command, field string) (string, error)
+	// SetSecret saves the value of a secret field.
+	SetSecret(command, field, value string) error
+}
+
+type memorySecretStore struct {
+	lck     sync.Mutex
+	secrets map[string]string
+}
+
+// NewMemorySecretStore returns a secret store that keeps the values in memory.
+// Values are lost when the server is restarted.
+func NewMemorySecretStore() SecretStore {
+	return &memorySecretStore{secrets: map[string]string{}}
+}
+
+func (s *memorySecretStore) Secret(command, field string) (string, error) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	return s.secrets[command+"\x00"+field], nil
+}
+
+func (s *memorySecretStore) SetSecret(command, field, value string) error {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	s.secrets[command+"\x00"+field] = value
+	return nil
+}
+
+// markSecrets marks as secret the fields whose name matches the secret
+// pattern. Fields are copied to avoid modifying the commands of the caller.
+func (o *options) markSecrets(cmds []*parsedCommand) {
+	if o.secretPattern == nil {
+		return
+	}
+	for _, cmd := range cmds {
+		fields := make([]*Field, len(cmd.Fields))
+		for i, f := range cmd.Fields {
+			if !f.Secret && o.secretPattern.MatchString(f.Name) {
+				copied := *f
+				copied.Secret = true
+				f = &copied
+			}
+			fields[i] = f
+		}
+		cmd.Fields = fields
+	}
+}
+
+// secret returns the saved value of a secret field, if any.
+func (o *options) secret(command, field string) string {
+	if o.secretStore == nil {
+		return ""
+	}
+	v, err := o.secretStore.Secret(command, field)
+	if err != nil {
+		log.Println("webcli: couldn't get secret:", err)
+		return ""
+	}
+	return v
+}
+
+// redact returns a copy of the arguments with the values of the secret fields
+// replaced.
+func (c *parsedCommand) redact(args []string) []string {
+	secrets := map[string]bool{}
+	for _, f := range c.Fields {
+		if f.Secret {
+			secrets[f.Name] = true
+		}
+	}
+	copied := make([]string, len(args))
+	for i, arg := range args {
+		name, _, ok := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if ok && strings.HasPrefix(arg, "--") && secrets[name] {
+			arg = "--" + name + "=" + redacted
+		}
+		copied[i] = arg
+	}
+	return copied
+}
@@ -0,0 +1,21 @@
+// Joins the lines of the output shown as it is published. Records that
+// continue a partial line have a data-continues attribute with the sequence
+// number of the line, and their content is moved to it.
+(function() {
+	htmx.onLoad(function(elt) {
+		var elements = Array.prototype.slice.call(elt.querySelectorAll('[data-continues]'));
+		if (elt.matches && elt.matches('[data-continues]')) {
+			elements.push(elt);
+		}
+		elements.forEach(function(el) {
+			var line = document.querySelector('#log [data-seq="' + el.dataset.continues + '"]');
+			if (!line || line === el) {
+				return;
+			}
+			while (el.firstChild) {
+				line.appendChild(el.firstChild);
+			}
+			el.remove();
+		});
+	});
+})();
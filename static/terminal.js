@@ -0,0 +1,710 @@
+// Minimal terminal emulator for the processes attached to a terminal.
+// Elements with a data-terminal attribute are connected to the websocket in
+// the attribute, which streams the raw output of the process. Keystrokes and
+// the window size are sent back to the process.
+(function() {
+	var palette = [
+		'#000000', '#cd0000', '#00cd00', '#cdcd00', '#0000ee', '#cd00cd', '#00cdcd', '#e5e5e5',
+		'#7f7f7f', '#ff0000', '#00ff00', '#ffff00', '#5c5cff', '#ff00ff', '#00ffff', '#ffffff'
+	];
+	var defaultAttr = {fg: null, bg: null, bold: false, underline: false, inverse: false};
+	var maxScrollback = 1000;
+
+	function rgb(r, g, b) {
+		return 'rgb(' + r + ',' + g + ',' + b + ')';
+	}
+
+	// color returns the CSS color of an entry of the 256 color palette.
+	function color(n) {
+		if (n < 16) {
+			return palette[n];
+		}
+		if (n < 232) {
+			var levels = [0, 95, 135, 175, 215, 255];
+			n -= 16;
+			return rgb(levels[Math.floor(n / 36)], levels[Math.floor(n / 6) % 6], levels[n % 6]);
+		}
+		var v = 8 + (n - 232) * 10;
+		return rgb(v, v, v);
+	}
+
+	function escapeHTML(s) {
+		return s.replace(/&/g, '&amp;').replace(/</g, '&lt;').replace(/>/g, '&gt;');
+	}
+
+	function Terminal(el, url) {
+		this.el = el;
+		this.history = document.createElement('div');
+		this.screen = document.createElement('div');
+		el.innerHTML = '';
+		el.appendChild(this.history);
+		el.appendChild(this.screen);
+		this.decoder = new TextDecoder('utf-8');
+		this.encoder = new TextEncoder();
+		this.state = 'normal';
+		this.seq = '';
+		this.attr = defaultAttr;
+		this.reset(80, 24);
+		this.measure();
+		this.fit();
+		this.connect(url);
+		this.listen();
+	}
+
+	Terminal.prototype.reset = function(cols, rows) {
+		this.cols = cols;
+		this.rows = rows;
+		this.lines = [];
+		for (var i = 0; i < rows; i++) {
+			this.lines.push(this.blankLine());
+		}
+		this.x = 0;
+		this.y = 0;
+		this.top = 0;
+		this.bottom = rows - 1;
+		this.wrapPending = false;
+		this.cursorVisible = true;
+		this.appCursor = false;
+		this.alt = null;
+		this.saved = {x: 0, y: 0, attr: defaultAttr};
+	};
+
+	Terminal.prototype.blankCell = function() {
+		var a = this.attr.bg === null ? defaultAttr : {fg: null, bg: this.attr.bg, bold: false, underline: false, inverse: false};
+		return {c: ' ', a: a};
+	};
+
+	Terminal.prototype.blankLine = function() {
+		var line = [];
+		for (var i = 0; i < this.cols; i++) {
+			line.push(this.blankCell());
+		}
+		return line;
+	};
+
+	// measure obtains the size of a character with the font of the terminal.
+	Terminal.prototype.measure = function() {
+		var probe = document.createElement('span');
+		probe.textContent = 'WWWWWWWWWW';
+		probe.style.visibility = 'hidden';
+		probe.style.whiteSpace = 'pre';
+		probe.style.display = 'inline-block';
+		this.screen.appendChild(probe);
+		var rect = probe.getBoundingClientRect();
+		this.screen.removeChild(probe);
+		this.charWidth = rect.width / 10 || 8;
+		this.charHeight = rect.height || 16;
+	};
+
+	// fit resizes the terminal to the size of its element.
+	Terminal.prototype.fit = function() {
+		var style = getComputedStyle(this.el);
+		var width = this.el.clientWidth - parseFloat(style.paddingLeft) - parseFloat(style.paddingRight);
+		var height = this.el.clientHeight - parseFloat(style.paddingTop) - parseFloat(style.paddingBottom);
+		var cols = Math.max(10, Math.floor(width / this.charWidth));
+		var rows = Math.max(2, Math.floor(height / this.charHeight));
+		if (cols !== this.cols || rows !== this.rows) {
+			this.resize(cols, rows);
+		}
+		this.sendSize();
+	};
+
+	Terminal.prototype.resize = function(cols, rows) {
+		var adjust = function(lines) {
+			lines.forEach(function(line) {
+				while (line.length < cols) {
+					line.push({c: ' ', a: defaultAttr});
+				}
+				line.length = cols;
+			});
+			return lines;
+		};
+		this.cols = cols;
+		adjust(this.lines);
+		if (this.alt) {
+			adjust(this.alt.lines);
+		}
+		// Lines above the cursor are moved to the scrollback when shrinking
+		while (this.lines.length > rows && this.y > 0) {
+			this.pushScrollback(this.lines.shift());
+			this.y--;
+		}
+		this.lines.length = Math.min(this.lines.length, rows);
+		while (this.lines.length < rows) {
+			this.lines.push(this.blankLine());
+		}
+		this.rows = rows;
+		this.top = 0;
+		this.bottom = rows - 1;
+		this.x = Math.min(this.x, cols - 1);
+		this.y = Math.min(this.y, rows - 1);
+		this.wrapPending = false;
+		this.render();
+	};
+
+	Terminal.prototype.connect = function(url) {
+		var self = this;
+		var scheme = location.protocol === 'https:' ? 'wss://' : 'ws://';
+		this.ws = new WebSocket(scheme + location.host + url);
+		this.ws.binaryType = 'arraybuffer';
+		this.ws.onopen = function() {
+			self.sendSize();
+		};
+		this.ws.onmessage = function(e) {
+			self.write(self.decoder.decode(new Uint8Array(e.data), {stream: true}));
+		};
+	};
+
+	Terminal.prototype.send = function(data) {
+		if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+			this.ws.send(this.encoder.encode(data));
+		}
+	};
+
+	Terminal.prototype.sendSize = function() {
+		if (this.ws && this.ws.readyState === WebSocket.OPEN) {
+			this.ws.send(JSON.stringify({type: 'resize', cols: this.cols, rows: this.rows}));
+		}
+	};
+
+	Terminal.prototype.listen = function() {
+		var self = this;
+		this.el.addEventListener('keydown', function(e) {
+			var data = keyData(e, self.appCursor);
+			if (data !== null) {
+				e.preventDefault();
+				self.send(data);
+			}
+		});
+		this.el.addEventListener('paste', function(e) {
+			e.preventDefault();
+			self.send(e.clipboardData.getData('text').replace(/\r?\n/g, '\r'));
+		});
+		var onResize = function() {
+			if (!self.el.isConnected) {
+				window.removeEventListener('resize', onResize);
+				return;
+			}
+			self.fit();
+		};
+		window.addEventListener('resize', onResize);
+		// Close the connection when htmx removes the terminal from the page
+		this.el.addEventListener('htmx:beforeCleanupElement', function() {
+			window.removeEventListener('resize', onResize);
+			self.ws.close();
+		});
+	};
+
+	// keyData returns the bytes sent to the process for a key, or null if the
+	// key is handled by the browser.
+	function keyData(e, appCursor) {
+		var cursor = {ArrowUp: 'A', ArrowDown: 'B', ArrowRight: 'C', ArrowLeft: 'D', Home: 'H', End: 'F'};
+		if (cursor[e.key]) {
+			return (appCursor ? '\x1bO' : '\x1b[') + cursor[e.key];
+		}
+		var keys = {
+			Enter: '\r', Backspace: '\x7f', Tab: '\t', Escape: '\x1b',
+			Insert: '\x1b[2~', Delete: '\x1b[3~', PageUp: '\x1b[5~', PageDown: '\x1b[6~',
+			F1: '\x1bOP', F2: '\x1bOQ', F3: '\x1bOR', F4: '\x1bOS'
+		};
+		if (keys[e.key]) {
+			return keys[e.key];
+		}
+		// Shortcuts of the browser, such as copy, are kept
+		if (e.key.length !== 1 || e.metaKey || (e.ctrlKey && e.shiftKey)) {
+			return null;
+		}
+		if (e.ctrlKey) {
+			if (e.key === ' ') {
+				return '\x00';
+			}
+			var code = e.key.toUpperCase().charCodeAt(0);
+			return code >= 64 && code <= 95 ? String.fromCharCode(code - 64) : null;
+		}
+		if (e.altKey) {
+			return '\x1b' + e.key;
+		}
+		return e.key;
+	}
+
+	// write parses the output of the process.
+	Terminal.prototype.write = function(text) {
+		for (var i = 0; i < text.length; i++) {
+			var ch = text[i];
+			switch (this.state) {
+			case 'normal':
+				this.control(ch);
+				break;
+			case 'esc':
+				this.escape(ch);
+				break;
+			case 'csi':
+				if (ch >= '@' && ch <= '~') {
+					this.state = 'normal';
+					this.csi(this.seq, ch);
+				} else {
+					this.seq += ch;
+				}
+				break;
+			case 'osc':
+				// Operating system commands, such as the title, are ignored
+				if (ch === '\x07') {
+					this.state = 'normal';
+				} else if (ch === '\x1b') {
+					this.state = 'esc';
+				}
+				break;
+			case 'charset':
+				this.state = 'normal';
+				break;
+			}
+		}
+		this.render();
+	};
+
+	Terminal.prototype.control = function(ch) {
+		switch (ch) {
+		case '\x1b':
+			this.state = 'esc';
+			break;
+		case '\r':
+			this.x = 0;
+			this.wrapPending = false;
+			break;
+		case '\n':
+		case '\x0b':
+		case '\x0c':
+			this.lineFeed();
+			break;
+		case '\b':
+			if (this.x > 0) {
+				this.x--;
+			}
+			this.wrapPending = false;
+			break;
+		case '\t':
+			this.x = Math.min(this.cols - 1, (Math.floor(this.x / 8) + 1) * 8);
+			break;
+		case '\x07':
+		case '\x00':
+			break;
+		default:
+			this.put(ch);
+		}
+	};
+
+	Terminal.prototype.escape = function(ch) {
+		this.state = 'normal';
+		switch (ch) {
+		case '[':
+			this.state = 'csi';
+			this.seq = '';
+			break;
+		case ']':
+			this.state = 'osc';
+			break;
+		case '(':
+		case ')':
+			this.state = 'charset';
+			break;
+		case '7':
+			this.saveCursor();
+			break;
+		case '8':
+			this.restoreCursor();
+			break;
+		case 'D':
+			this.lineFeed();
+			break;
+		case 'E':
+			this.x = 0;
+			this.lineFeed();
+			break;
+		case 'M':
+			if (this.y === this.top) {
+				this.scrollDown(1);
+			} else if (this.y > 0) {
+				this.y--;
+			}
+			break;
+		case 'c':
+			this.attr = defaultAttr;
+			this.reset(this.cols, this.rows);
+			break;
+		}
+	};
+
+	Terminal.prototype.put = function(ch) {
+		if (ch < ' ') {
+			return;
+		}
+		if (this.wrapPending) {
+			this.x = 0;
+			this.lineFeed();
+		}
+		this.lines[this.y][this.x] = {c: ch, a: this.attr};
+		if (this.x === this.cols - 1) {
+			this.wrapPending = true;
+		} else {
+			this.x++;
+		}
+	};
+
+	Terminal.prototype.lineFeed = function() {
+		this.wrapPending = false;
+		if (this.y === this.bottom) {
+			this.scrollUp(1);
+		} else if (this.y < this.rows - 1) {
+			this.y++;
+		}
+	};
+
+	Terminal.prototype.scrollUp = function(n) {
+		for (var i = 0; i < n; i++) {
+			var removed = this.lines.splice(this.top, 1)[0];
+			if (!this.alt && this.top === 0) {
+				this.pushScrollback(removed);
+			}
+			this.lines.splice(this.bottom, 0, this.blankLine());
+		}
+	};
+
+	Terminal.prototype.scrollDown = function(n) {
+		for (var i = 0; i < n; i++) {
+			this.lines.splice(this.bottom, 1);
+			this.lines.splice(this.top, 0, this.blankLine());
+		}
+	};
+
+	Terminal.prototype.pushScrollback = function(line) {
+		var div = document.createElement('div');
+		div.innerHTML = lineHTML(line, -1);
+		this.history.appendChild(div);
+		while (this.history.childNodes.length > maxScrollback) {
+			this.history.removeChild(this.history.firstChild);
+		}
+	};
+
+	Terminal.prototype.saveCursor = function() {
+		this.saved = {x: this.x, y: this.y, attr: this.attr};
+	};
+
+	Terminal.prototype.restoreCursor = function() {
+		this.x = Math.min(this.saved.x, this.cols - 1);
+		this.y = Math.min(this.saved.y, this.rows - 1);
+		this.attr = this.saved.attr;
+		this.wrapPending = false;
+	};
+
+	Terminal.prototype.csi = function(seq, final) {
+		var prefix = '';
+		if (seq && '?>=<'.indexOf(seq[0]) >= 0) {
+			prefix = seq[0];
+			seq = seq.slice(1);
+		}
+		var params = seq.replace(/:/g, ';').split(';').map(function(p) {
+			return p === '' ? 0 : parseInt(p, 10) || 0;
+		});
+		var n = Math.max(1, params[0] || 0);
+		if (prefix === '?') {
+			this.privateMode(params, final === 'h');
+			return;
+		}
+		if (prefix !== '') {
+			return;
+		}
+		this.wrapPending = false;
+		switch (final) {
+		case 'A':
+			this.y = Math.max(this.y < this.top ? 0 : this.top, this.y - n);
+			break;
+		case 'B':
+			this.y = Math.min(this.y > this.bottom ? this.rows - 1 : this.bottom, this.y + n);
+			break;
+		case 'C':
+			this.x = Math.min(this.cols - 1, this.x + n);
+			break;
+		case 'D':
+			this.x = Math.max(0, this.x - n);
+			break;
+		case 'E':
+			this.x = 0;
+			this.y = Math.min(this.rows - 1, this.y + n);
+			break;
+		case 'F':
+			this.x = 0;
+			this.y = Math.max(0, this.y - n);
+			break;
+		case 'G':
+		case '`':
+			this.x = Math.min(this.cols - 1, n - 1);
+			break;
+		case 'd':
+			this.y = Math.min(this.rows - 1, n - 1);
+			break;
+		case 'H':
+		case 'f':
+			this.y = Math.min(this.rows - 1, Math.max(1, params[0] || 0) - 1);
+			this.x = Math.min(this.cols - 1, Math.max(1, params[1] || 0) - 1);
+			break;
+		case 'J':
+			this.eraseDisplay(params[0] || 0);
+			break;
+		case 'K':
+			this.eraseLine(params[0] || 0);
+			break;
+		case 'L':
+			if (this.y >= this.top && this.y <= this.bottom) {
+				for (var i = 0; i < n; i++) {
+					this.lines.splice(this.bottom, 1);
+					this.lines.splice(this.y, 0, this.blankLine());
+				}
+			}
+			break;
+		case 'M':
+			if (this.y >= this.top && this.y <= this.bottom) {
+				for (var j = 0; j < n; j++) {
+					this.lines.splice(this.y, 1);
+					this.lines.splice(this.bottom, 0, this.blankLine());
+				}
+			}
+			break;
+		case '@':
+			var line = this.lines[this.y];
+			for (var k = 0; k < n; k++) {
+				line.splice(this.x, 0, this.blankCell());
+			}
+			line.length = this.cols;
+			break;
+		case 'P':
+			var deleted = this.lines[this.y];
+			deleted.splice(this.x, n);
+			while (deleted.length < this.cols) {
+				deleted.push(this.blankCell());
+			}
+			break;
+		case 'X':
+			for (var m = this.x; m < Math.min(this.cols, this.x + n); m++) {
+				this.lines[this.y][m] = this.blankCell();
+			}
+			break;
+		case 'S':
+			this.scrollUp(n);
+			break;
+		case 'T':
+			this.scrollDown(n);
+			break;
+		case 'r':
+			var top = Math.max(1, params[0] || 1) - 1;
+			var bottom = Math.min(this.rows, params[1] || this.rows) - 1;
+			if (top < bottom) {
+				this.top = top;
+				this.bottom = bottom;
+				this.x = 0;
+				this.y = 0;
+			}
+			break;
+		case 's':
+			this.saveCursor();
+			break;
+		case 'u':
+			this.restoreCursor();
+			break;
+		case 'm':
+			this.sgr(params);
+			break;
+		}
+	};
+
+	Terminal.prototype.privateMode = function(params, set) {
+		for (var i = 0; i < params.length; i++) {
+			switch (params[i]) {
+			case 1:
+				this.appCursor = set;
+				break;
+			case 25:
+				this.cursorVisible = set;
+				break;
+			case 47:
+			case 1047:
+			case 1049:
+				this.alternateScreen(set);
+				break;
+			}
+		}
+	};
+
+	// alternateScreen switches between the main screen and the alternate
+	// screen used by full screen programs.
+	Terminal.prototype.alternateScreen = function(enter) {
+		if (enter && !this.alt) {
+			this.saveCursor();
+			this.alt = {lines: this.lines};
+			this.lines = [];
+			for (var i = 0; i < this.rows; i++) {
+				this.lines.push(this.blankLine());
+			}
+		} else if (!enter && this.alt) {
+			this.lines = this.alt.lines;
+			this.alt = null;
+			this.restoreCursor();
+		}
+	};
+
+	Terminal.prototype.eraseDisplay = function(mode) {
+		var from = 0;
+		var to = this.rows;
+		if (mode === 0) {
+			this.eraseLine(0);
+			from = this.y + 1;
+		} else if (mode === 1) {
+			this.eraseLine(1);
+			to = this.y;
+		}
+		for (var i = from; i < to; i++) {
+			this.lines[i] = this.blankLine();
+		}
+		if (mode === 3) {
+			this.history.innerHTML = '';
+		}
+	};
+
+	Terminal.prototype.eraseLine = function(mode) {
+		var from = mode === 0 ? this.x : 0;
+		var to = mode === 1 ? this.x + 1 : this.cols;
+		for (var i = from; i < to; i++) {
+			this.lines[this.y][i] = this.blankCell();
+		}
+	};
+
+	// sgr applies the select graphic rendition parameters.
+	Terminal.prototype.sgr = function(params) {
+		var a = {fg: this.attr.fg, bg: this.attr.bg, bold: this.attr.bold, underline: this.attr.underline, inverse: this.attr.inverse};
+		for (var i = 0; i < params.length; i++) {
+			var p = params[i];
+			if (p === 0) {
+				a = {fg: null, bg: null, bold: false, underline: false, inverse: false};
+			} else if (p === 1) {
+				a.bold = true;
+			} else if (p === 4) {
+				a.underline = true;
+			} else if (p === 7) {
+				a.inverse = true;
+			} else if (p === 22) {
+				a.bold = false;
+			} else if (p === 24) {
+				a.underline = false;
+			} else if (p === 27) {
+				a.inverse = false;
+			} else if (p >= 30 && p <= 37) {
+				a.fg = palette[p - 30];
+			} else if (p === 39) {
+				a.fg = null;
+			} else if (p >= 40 && p <= 47) {
+				a.bg = palette[p - 40];
+			} else if (p === 49) {
+				a.bg = null;
+			} else if (p >= 90 && p <= 97) {
+				a.fg = palette[p - 90 + 8];
+			} else if (p >= 100 && p <= 107) {
+				a.bg = palette[p - 100 + 8];
+			} else if (p === 38 || p === 48) {
+				var c = null;
+				if (params[i + 1] === 5) {
+					c = color(params[i + 2] & 255);
+					i += 2;
+				} else if (params[i + 1] === 2) {
+					c = rgb(params[i + 2] & 255, params[i + 3] & 255, params[i + 4] & 255);
+					i += 4;
+				}
+				if (p === 38) {
+					a.fg = c;
+				} else {
+					a.bg = c;
+				}
+			}
+		}
+		this.attr = a;
+	};
+
+	// lineHTML renders a line, showing the cursor at the given column.
+	function lineHTML(line, cursor) {
+		var html = '';
+		var text = '';
+		var current = null;
+		var flush = function() {
+			if (text === '') {
+				return;
+			}
+			html += current ? '<span style="' + current + '">' + escapeHTML(text) + '</span>' : escapeHTML(text);
+			text = '';
+		};
+		for (var i = 0; i < line.length; i++) {
+			var style = cellStyle(line[i].a, i === cursor);
+			if (style !== current) {
+				flush();
+				current = style;
+			}
+			text += line[i].c;
+		}
+		flush();
+		return html.replace(/\s+$/, '') || ' ';
+	}
+
+	function cellStyle(a, cursor) {
+		var fg = a.fg;
+		var bg = a.bg;
+		if (a.inverse !== cursor) {
+			fg = a.bg || '#111827';
+			bg = a.fg || '#f3f4f6';
+		}
+		var style = '';
+		if (fg) {
+			style += 'color:' + fg + ';';
+		}
+		if (bg) {
+			style += 'background-color:' + bg + ';';
+		}
+		if (a.bold) {
+			style += 'font-weight:bold;';
+		}
+		if (a.underline) {
+			style += 'text-decoration:underline;';
+		}
+		return style || null;
+	}
+
+	// render updates the screen in the next animation frame.
+	Terminal.prototype.render = function() {
+		var self = this;
+		if (this.rendering) {
+			return;
+		}
+		this.rendering = true;
+		requestAnimationFrame(function() {
+			self.rendering = false;
+			var atBottom = self.el.scrollTop + self.el.clientHeight >= self.el.scrollHeight - self.charHeight;
+			var html = '';
+			for (var y = 0; y < self.rows; y++) {
+				var cursor = self.cursorVisible && y === self.y ? self.x : -1;
+				html += '<div>' + lineHTML(self.lines[y], cursor) + '</div>';
+			}
+			self.screen.innerHTML = html;
+			if (atBottom) {
+				self.el.scrollTop = self.el.scrollHeight;
+			}
+		});
+	};
+
+	htmx.onLoad(function(elt) {
+		var elements = Array.prototype.slice.call(elt.querySelectorAll('[data-terminal]'));
+		if (elt.matches && elt.matches('[data-terminal]')) {
+			elements.push(elt);
+		}
+		elements.forEach(function(el) {
+			if (!el.terminal) {
+				el.terminal = new Terminal(el, el.dataset.terminal);
+			}
+		});
+	});
+})();
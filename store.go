@@ -0,0 +1,281 @@
+package webcli
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Run is the record of a launched command.
+type Run struct {
+	ID      string   `json:"id"`
+	Command string   `json:"command"`
+	Args    []string `json:"args"`
+	// EffectiveArgs are the arguments including the default values of the
+	// flags that weren't passed explicitly.
+	EffectiveArgs []string      `json:"effective_args,omitempty"`
+	Start         time.Time     `json:"start"`
+	End           time.Time     `json:"end"`
+	Error         bool          `json:"error,omitempty"`
+	Canceled      bool          `json:"canceled,omitempty"`
+	Interrupted   bool          `json:"interrupted,omitempty"`
+	ExitCode      int           `json:"exit_code"`
+	Signal        string        `json:"signal,omitempty"`
+	UserTime      time.Duration `json:"user_time"`
+	SystemTime    time.Duration `json:"system_time"`
+	// Input are the lines sent to the standard input.
+	Input []RunInput `json:"input,omitempty"`
+	// Stopping is set while a canceled command is given time to exit.
+	Stopping bool `json:"stopping,omitempty"`
+	// Terminal is set if the command was attached to a terminal.
+	Terminal bool `json:"terminal,omitempty"`
+}
+
+// RunInput is a line sent to the standard input of a run.
+type RunInput struct {
+	Time time.Time `json:"time"`
+	Line string    `json:"line"`
+	// EOF is set if the standard input was closed after the line.
+	EOF bool `json:"eof,omitempty"`
+}
+
+// ErrRunNotFound is returned by run stores when a run doesn't exist.
+var ErrRunNotFound = errors.New("webcli: run not found")
+
+// RunStore stores the history of launched commands.
+type RunStore interface {
+	// Create stores a new run and returns a writer for its output, which is
+	// written as a sequence of log records (see LogRecord).
+	Create(run *Run) (io.WriteCloser, error)
+	// Update stores the updated metadata of a run.
+	Update(run *Run) error
+	// List returns all the stored runs, from newest to oldest.
+	List() ([]*Run, error)
+	// Get returns the stored run with the given ID.
+	Get(id string) (*Run, error)
+	// Output returns a reader for the stored output of a run.
+	Output(id string) (io.ReadSeekCloser, error)
+}
+
+const (
+	runFile    = "run.json"
+	outputFile = "output.log"
+)
+
+type dirRunStore struct {
+	dir string
+}
+
+// NewDirRunStore returns a run store that saves each run in its own directory
+// inside dir, with the metadata in a JSON file and the output in a log file.
+func NewDirRunStore(dir string) RunStore {
+	return &dirRunStore{dir: dir}
+}
+
+func (s *dirRunStore) Create(run *Run) (io.WriteCloser, error) {
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return nil, fmt.Errorf("webcli: couldn't create folder %s: %w", s.dir, err)
+	}
+	runDir := filepath.Join(s.dir, run.ID)
+	if err := os.Mkdir(runDir, 0755); err != nil {
+		return nil, fmt.Errorf("webcli: couldn't create folder %s: %w", runDir, err)
+	}
+	if err := s.Update(run); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(filepath.Join(runDir, outputFile))
+	if err != nil {
+		return nil, fmt.Errorf("webcli: couldn't create output file: %w", err)
+	}
+	return f, nil
+}
+
+func (s *dirRunStore) Update(run *Run) error {
+	b, err := json.MarshalIndent(run, "", "  ")
+	if err != nil {
+		return fmt.Errorf("webcli: couldn't marshal run %s: %w", run.ID, err)
+	}
+
+	// Write to a temporary file and rename it to avoid partial writes
+	path := filepath.Join(s.dir, run.ID, runFile)
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0644); err != nil {
+		return fmt.Errorf("webcli: couldn't write file %s: %w", tmp, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("webcli: couldn't rename file %s: %w", tmp, err)
+	}
+	return nil
+}
+
+func (s *dirRunStore) List() ([]*Run, error) {
+	entries, err := os.ReadDir(s.dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("webcli: couldn't read folder %s: %w", s.dir, err)
+	}
+	var runs []*Run
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		run, err := s.Get(e.Name())
+		if err != nil {
+			// Ignore folders that aren't runs
+			continue
+		}
+		runs = append(runs, run)
+	}
+	sortRuns(runs)
+	return runs, nil
+}
+
+func (s *dirRunStore) Get(id string) (*Run, error) {
+	if !validRunID(id) {
+		return nil, ErrRunNotFound
+	}
+	b, err := os.ReadFile(filepath.Join(s.dir, id, runFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrRunNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("webcli: couldn't read run %s: %w", id, err)
+	}
+	var run Run
+	if err := json.Unmarshal(b, &run); err != nil {
+		return nil, fmt.Errorf("webcli: couldn't unmarshal run %s: %w", id, err)
+	}
+	return &run, nil
+}
+
+func (s *dirRunStore) Output(id string) (io.ReadSeekCloser, error) {
+	if !validRunID(id) {
+		return nil, ErrRunNotFound
+	}
+	f, err := os.Open(filepath.Join(s.dir, id, outputFile))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrRunNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("webcli: couldn't open output of run %s: %w", id, err)
+	}
+	return f, nil
+}
+
+// validRunID checks that the ID can be safely used as a folder name.
+func validRunID(id string) bool {
+	return id != "" && id != "." && id != ".." && filepath.Base(id) == id
+}
+
+type memoryRunStore struct {
+	lck     sync.Mutex
+	runs    map[string]*Run
+	outputs map[string]*memoryOutput
+}
+
+// NewMemoryRunStore returns a run store that keeps the runs in memory.
+// Runs are lost when the server is restarted.
+func NewMemoryRunStore() RunStore {
+	return &memoryRunStore{
+		runs:    map[string]*Run{},
+		outputs: map[string]*memoryOutput{},
+	}
+}
+
+func (s *memoryRunStore) Create(run *Run) (io.WriteCloser, error) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	if _, ok := s.runs[run.ID]; ok {
+		return nil, fmt.Errorf("webcli: run %s already exists", run.ID)
+	}
+	copied := *run
+	s.runs[run.ID] = &copied
+	output := &memoryOutput{}
+	s.outputs[run.ID] = output
+	return output, nil
+}
+
+func (s *memoryRunStore) Update(run *Run) error {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	if _, ok := s.runs[run.ID]; !ok {
+		return ErrRunNotFound
+	}
+	copied := *run
+	s.runs[run.ID] = &copied
+	return nil
+}
+
+func (s *memoryRunStore) List() ([]*Run, error) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	var runs []*Run
+	for _, run := range s.runs {
+		copied := *run
+		runs = append(runs, &copied)
+	}
+	sortRuns(runs)
+	return runs, nil
+}
+
+func (s *memoryRunStore) Get(id string) (*Run, error) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	run, ok := s.runs[id]
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+	copied := *run
+	return &copied, nil
+}
+
+func (s *memoryRunStore) Output(id string) (io.ReadSeekCloser, error) {
+	s.lck.Lock()
+	defer s.lck.Unlock()
+	output, ok := s.outputs[id]
+	if !ok {
+		return nil, ErrRunNotFound
+	}
+	return nopCloser{bytes.NewReader(output.Bytes())}, nil
+}
+
+type memoryOutput struct {
+	lck sync.Mutex
+	buf bytes.Buffer
+}
+
+func (o *memoryOutput) Write(p []byte) (int, error) {
+	o.lck.Lock()
+	defer o.lck.Unlock()
+	return o.buf.Write(p)
+}
+
+func (o *memoryOutput) Close() error { return nil }
+
+func (o *memoryOutput) Bytes() []byte {
+	o.lck.Lock()
+	defer o.lck.Unlock()
+	return bytes.Clone(o.buf.Bytes())
+}
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (nopCloser) Close() error { return nil }
+
+// sortRuns orders runs from newest to oldest.
+func sortRuns(runs []*Run) {
+	sort.Slice(runs, func(i, j int) bool {
+		return runs[i].Start.After(runs[j].Start)
+	})
+}
@@ -0,0 +1,146 @@
+package webcli
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// maxTerminalMessage is the maximum size of the messages received from the
+// terminal in the browser.
+const maxTerminalMessage = 64 << 10
+
+// terminalUpgrader upgrades the connections of the terminal. Browsers allow
+// websockets to any site, so it only accepts requests from the same origin to
+// prevent other sites from using the session of the user.
+var terminalUpgrader = websocket.Upgrader{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+}
+
+// closeWebSocket sends a normal closure message and closes the connection.
+func closeWebSocket(conn *websocket.Conn) {
+	msg := websocket.FormatCloseMessage(websocket.CloseNormalClosure, "")
+	_ = conn.WriteControl(websocket.CloseMessage, msg, time.Now().Add(time.Second))
+	_ = conn.Close()
+}
+
+// terminalMessage is a control message sent by the terminal in the browser
+// as a text frame. Keystrokes are sent as binary frames.
+type terminalMessage struct {
+	Type string `json:"type"`
+	Cols int    `json:"cols"`
+	Rows int    `json:"rows"`
+}
+
+// serveTerminal streams the raw output of the process to the terminal in the
+// browser until the process ends or the connection is closed.
+// If input is set, keystrokes and resize events of the browser are sent to
+// the process.
+// The output is queued while it is sent, so a slow browser never blocks the
+// process. The connection is closed if it falls behind by more than
+// maxPending bytes.
+func serveTerminal(conn *websocket.Conn, proc *process, input bool, maxPending int) {
+	var (
+		queueLck sync.Mutex
+		queue    []byte
+		lagging  bool
+	)
+	wake := make(chan struct{}, 1)
+
+	// Subscribe to the raw output of the process
+	subID := fmt.Sprintf("%d", time.Now().UnixNano())
+	tail := proc.SubscribeRaw(subID, func(data []byte, close bool) {
+		if len(data) == 0 {
+			return
+		}
+		queueLck.Lock()
+		if len(queue)+len(data) > maxPending {
+			lagging, queue = true, nil
+		}
+		if !lagging {
+			queue = append(queue, data...)
+		}
+		queueLck.Unlock()
+		select {
+		case wake <- struct{}{}:
+		default:
+		}
+	})
+	defer proc.Unsubscribe(subID)
+
+	// send writes the queued output, it returns false if the connection
+	// must be closed
+	send := func() bool {
+		queueLck.Lock()
+		data, ended := queue, lagging
+		queue = nil
+		queueLck.Unlock()
+		if ended {
+			return false
+		}
+		if len(data) == 0 {
+			return true
+		}
+		return conn.WriteMessage(websocket.BinaryMessage, data) == nil
+	}
+
+	if len(tail) > 0 {
+		if err := conn.WriteMessage(websocket.BinaryMessage, tail); err != nil {
+			return
+		}
+	}
+
+	// Read keystrokes and control messages from the browser
+	conn.SetReadLimit(maxTerminalMessage)
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			op, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if !input {
+				continue
+			}
+			switch op {
+			case websocket.BinaryMessage:
+				if err := proc.WriteTerminal(msg); err != nil {
+					log.Println(err)
+				}
+			case websocket.TextMessage:
+				var m terminalMessage
+				if err := json.Unmarshal(msg, &m); err != nil {
+					log.Println("webcli: invalid terminal message:", err)
+					continue
+				}
+				if m.Type == "resize" {
+					if err := proc.Resize(m.Cols, m.Rows); err != nil {
+						log.Println(err)
+					}
+				}
+			}
+		}
+	}()
+
+	// Send the output to the browser
+	for {
+		select {
+		case <-wake:
+			if !send() {
+				return
+			}
+		case <-proc.Done():
+			// Send the output still pending before closing
+			send()
+			return
+		case <-closed:
+			return
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package webcli
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"mime/multipart"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+const (
+	// uploadMemory is the maximum size of the uploads kept in memory while
+	// parsing a multipart form, larger files are stored in temporary files.
+	uploadMemory = 32 << 20
+	// defaultMaxUploadSize is the default maximum size of the forms that
+	// launch commands, including the uploaded files.
+	defaultMaxUploadSize = 100 << 20
+)
+
+// stageUploads stores the files uploaded for the Upload fields in a new
+// temporary directory and sets their paths as the values of the fields.
+// Other values submitted for Upload fields are dropped, so paths of the
+// server can't be passed as if they were uploads.
+// The directory is returned, or an empty string if there are no uploads.
+func (o *options) stageUploads(r *http.Request, cmd *parsedCommand, values map[string][]string) (string, error) {
+	var dir string
+	for _, f := range cmd.Fields {
+		if f.Type != Upload {
+			continue
+		}
+		delete(values, f.Name)
+		if r.MultipartForm == nil {
+			continue
+		}
+		var files []*multipart.FileHeader
+		for _, fh := range r.MultipartForm.File[f.Name] {
+			// Empty file inputs are sent without a file name
+			if fh.Filename != "" {
+				files = append(files, fh)
+			}
+		}
+		if len(files) == 0 {
+			continue
+		}
+		if dir == "" {
+			var err error
+			dir, err = os.MkdirTemp("", "webcli-upload-")
+			if err != nil {
+				return "", fmt.Errorf("webcli: couldn't create upload directory: %w", err)
+			}
+		}
+		var paths []string
+		for i, fh := range files {
+			// Files are stored in a folder per field, and per file for arrays,
+			// to keep their original names
+			sub := filepath.Join(dir, f.Name)
+			if len(files) > 1 {
+				sub = filepath.Join(sub, strconv.Itoa(i))
+			}
+			path, err := saveUpload(fh, sub)
+			if err != nil {
+				_ = os.RemoveAll(dir)
+				return "", err
+			}
+			paths = append(paths, path)
+		}
+		values[f.Name] = paths
+	}
+	return dir, nil
+}
+
+// saveUpload copies an uploaded file to the given directory.
+func saveUpload(fh *multipart.FileHeader, dir string) (string, error) {
+	name := filepath.Base(fh.Filename)
+	if name == "." || name == ".." || name == string(filepath.Separator) {
+		name = "upload"
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", fmt.Errorf("webcli: couldn't create upload directory: %w", err)
+	}
+	src, err := fh.Open()
+	if err != nil {
+		return "", fmt.Errorf("webcli: couldn't open upload %s: %w", name, err)
+	}
+	defer src.Close()
+	path := filepath.Join(dir, name)
+	dst, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", fmt.Errorf("webcli: couldn't create upload %s: %w", name, err)
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = dst.Close()
+		return "", fmt.Errorf("webcli: couldn't write upload %s: %w", name, err)
+	}
+	if err := dst.Close(); err != nil {
+		return "", fmt.Errorf("webcli: couldn't write upload %s: %w", name, err)
+	}
+	return path, nil
+}
+
+// removeUploads removes the upload directory after the upload retention.
+// Negative retentions keep the directory.
+func (o *options) removeUploads(dir string) {
+	if dir == "" || o.uploadRetention < 0 {
+		return
+	}
+	remove := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			log.Println("webcli: couldn't remove uploads:", err)
+		}
+	}
+	if o.uploadRetention == 0 {
+		remove()
+		return
+	}
+	time.AfterFunc(o.uploadRetention, remove)
+}
@@ -0,0 +1,265 @@
+package webcli
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// fieldErrors maps the names of fields and positional arguments to their
+// validation errors.
+type fieldErrors map[string]string
+
+func (e fieldErrors) Error() string {
+	var names []string
+	for name := range e {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var msgs []string
+	for _, name := range names {
+		msgs = append(msgs, e[name])
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// validate checks the values entered for the field and returns them in the
+// format passed to the command.
+// Unset values are removed, so the command uses its default.
+func (f *Field) validate(values []string) ([]string, error) {
+	var parsed []string
+	for _, v := range values {
+		p, err := f.parse(v)
+		if err != nil {
+			return nil, err
+		}
+		// Unset values use the default of the command
+		if p == "" && (f.Type != Text || f.Secret) {
+			continue
+		}
+		// Convert checkbox on/off to true/false
+		if f.Type == Boolean {
+			switch p {
+			case "on":
+				p = "true"
+			case "off":
+				p = "false"
+			}
+		}
+		parsed = append(parsed, p)
+	}
+
+	var empty = true
+	for _, v := range parsed {
+		if v != "" {
+			empty = false
+		}
+	}
+	if empty {
+		if f.Required && f.Type != Boolean {
+			return nil, fmt.Errorf("%s is required", f.Name)
+		}
+		return parsed, nil
+	}
+
+	for _, v := range parsed {
+		if f.Type == Number && (f.Min != nil || f.Max != nil) {
+			n, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid number %q for %s", v, f.Name)
+			}
+			if f.Min != nil && n < *f.Min {
+				return nil, fmt.Errorf("%s must be greater than or equal to %s", f.Name, formatValue(*f.Min))
+			}
+			if f.Max != nil && n > *f.Max {
+				return nil, fmt.Errorf("%s must be less than or equal to %s", f.Name, formatValue(*f.Max))
+			}
+		}
+		if f.Pattern != "" {
+			re, err := regexp.Compile("^(?:" + f.Pattern + ")$")
+			if err != nil {
+				return nil, fmt.Errorf("invalid pattern of %s: %w", f.Name, err)
+			}
+			if !re.MatchString(v) {
+				return nil, fmt.Errorf("%s must match %s", f.Name, f.Pattern)
+			}
+		}
+		if f.Validate != nil {
+			if err := f.Validate(v); err != nil {
+				return nil, fmt.Errorf("invalid value for %s: %w", f.Name, err)
+			}
+		}
+	}
+	return parsed, nil
+}
+
+// flagArgs validates the values of the fields and returns them as flags.
+// Fields without values aren't passed to the command and empty secrets use
+// the value returned by secret, if any.
+// With changedOnly, values equal to the default of the field are omitted too.
+// The effective flags contain the values of all the fields, using the
+// defaults for the fields without values.
+// Errors are returned as fieldErrors.
+func (c *parsedCommand) flagArgs(values map[string][]string, secret func(field string) string, changedOnly bool) (args, effective []string, err error) {
+	errs := fieldErrors{}
+	for _, f := range c.Fields {
+		vs := values[f.Name]
+		if f.Secret && secret != nil && strings.Join(vs, "") == "" {
+			if s := secret(f.Name); s != "" {
+				vs = []string{s}
+			}
+		}
+		parsed, err := f.validate(vs)
+		if err != nil {
+			errs[f.Name] = err.Error()
+			continue
+		}
+		if len(parsed) == 0 {
+			effective = append(effective, f.flags(f.defaults())...)
+			continue
+		}
+		flags := f.flags(parsed)
+		effective = append(effective, flags...)
+		if changedOnly && f.isDefault(parsed) {
+			continue
+		}
+		args = append(args, flags...)
+	}
+	if len(errs) > 0 {
+		return nil, nil, errs
+	}
+	return args, effective, nil
+}
+
+// flags returns the flags of the values of the field.
+func (f *Field) flags(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	// Pairs of maps that aren't arrays are joined in a single flag
+	if f.Type == Map && !f.Array {
+		values = []string{strings.Join(values, ",")}
+	}
+	var flags []string
+	for _, v := range values {
+		flags = append(flags, fmt.Sprintf("--%s=%s", f.Name, v))
+	}
+	return flags
+}
+
+// defaults returns the default values of the field.
+func (f *Field) defaults() []string {
+	if !f.Array && f.Type != Map {
+		if f.Default == "" {
+			return nil
+		}
+		return []string{f.Default}
+	}
+	return splitArray(f.Default)
+}
+
+// isDefault reports whether the parsed values are the defaults of the field.
+func (f *Field) isDefault(values []string) bool {
+	defaults := f.defaults()
+	if f.Type == Boolean && len(defaults) == 0 {
+		defaults = []string{"false"}
+	}
+	if len(values) == 0 || (len(values) == 1 && values[0] == "") {
+		return len(defaults) == 0
+	}
+	if len(values) != len(defaults) {
+		return false
+	}
+	normalized := make([]string, len(defaults))
+	for i, def := range defaults {
+		if p, err := f.parse(def); err == nil {
+			def = p
+		}
+		normalized[i] = def
+	}
+	// Pairs of maps aren't ordered
+	if f.Type == Map {
+		values = append([]string(nil), values...)
+		sort.Strings(values)
+		sort.Strings(normalized)
+	}
+	for i, v := range values {
+		def := normalized[i]
+		if f.Type == Number {
+			a, errA := strconv.ParseFloat(v, 64)
+			b, errB := strconv.ParseFloat(def, 64)
+			if errA == nil && errB == nil && a == b {
+				continue
+			}
+		}
+		if v != def {
+			return false
+		}
+	}
+	return true
+}
+
+// positionalArgs returns the values of the positional arguments, preceded by
+// "--" so they aren't parsed as flags.
+// Errors are returned as fieldErrors.
+func (c *parsedCommand) positionalArgs(values map[string][]string) ([]string, error) {
+	var args []string
+	errs := fieldErrors{}
+	for _, a := range c.Args {
+		var vs []string
+		for _, v := range values[a.Name] {
+			if v != "" {
+				vs = append(vs, v)
+			}
+		}
+		switch {
+		case len(vs) == 0 && a.Required:
+			errs[a.Name] = fmt.Sprintf("argument %s is required", a.Name)
+		case len(vs) > 1 && !a.Variadic:
+			errs[a.Name] = fmt.Sprintf("argument %s only accepts one value", a.Name)
+		case !validOptions(a.Options, vs):
+			errs[a.Name] = fmt.Sprintf("invalid value for argument %s, must be one of: %s", a.Name, strings.Join(a.Options, ", "))
+		default:
+			args = append(args, vs...)
+		}
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if len(args) == 0 {
+		return nil, nil
+	}
+	return append([]string{"--"}, args...), nil
+}
+
+// validOptions reports whether all the values are in the options, if there
+// are any.
+func validOptions(options, values []string) bool {
+	if len(options) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if !slices.Contains(options, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkPatterns returns an error if the pattern of any field is invalid.
+func checkPatterns(cmds []*parsedCommand) error {
+	for _, cmd := range cmds {
+		for _, f := range cmd.Fields {
+			if f.Pattern == "" {
+				continue
+			}
+			if _, err := regexp.Compile(f.Pattern); err != nil {
+				return fmt.Errorf("webcli: invalid pattern of field %s of %s: %w", f.Name, cmd.Name, err)
+			}
+		}
+	}
+	return nil
+}
@@ -1,18 +1,26 @@
 package webcli
 
 import (
+	"bytes"
 	"context"
 	"embed"
+	"encoding/csv"
+	"errors"
 	"fmt"
 	"log"
 	"net"
 	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
 	"sort"
 	"strconv"
 	"strings"
 	"sync"
+	"syscall"
 	"time"
 
+	"github.com/gorilla/websocket"
 	"github.com/igolaizola/webcli/pkg/config"
 	"github.com/igolaizola/webcli/pkg/view"
 )
@@ -22,6 +30,52 @@ type Command struct {
 	Name        string
 	Description string
 	Subcommands []*Command
+	// Args are the positional arguments, passed after the flags.
+	Args []*Arg
+	// GracePeriod is how long the command is given to exit after being
+	// canceled before it is killed. Zero uses the default grace period (see
+	// WithGracePeriod) and negative values kill it right away.
+	GracePeriod time.Duration
+}
+
+// Arg is a positional argument of a command.
+type Arg struct {
+	Name        string
+	Description string
+	Required    bool
+	// Variadic arguments accept any number of values. Only the last argument
+	// can be variadic.
+	Variadic bool
+	// Options are the allowed values of the argument, shown as a select.
+	// Any value is allowed if empty.
+	Options []string
+	// Suggestions returns values offered while typing the argument, which
+	// aren't enforced. It is called each time the form is shown.
+	Suggestions func() []string
+}
+
+// usageArgRegexp matches the arguments of a usage string, e.g. "<src>",
+// "[dst]" or "<files>...".
+var usageArgRegexp = regexp.MustCompile(`^([<\[])([^>\]]+?)(\.\.\.)?([>\]])(\.\.\.)?$`)
+
+// ParseUsage returns the positional arguments of a usage string such as
+// "copy [flags] <src> <dst>", where "<arg>" is required, "[arg]" is optional
+// and "..." marks a variadic argument.
+func ParseUsage(usage string) []*Arg {
+	var args []*Arg
+	for _, token := range strings.Fields(usage) {
+		m := usageArgRegexp.FindStringSubmatch(token)
+		// Skip flags, e.g. "[flags]" or "[--force]"
+		if m == nil || strings.EqualFold(m[2], "flags") || strings.HasPrefix(m[2], "-") {
+			continue
+		}
+		args = append(args, &Arg{
+			Name:     m[2],
+			Required: m[1] == "<",
+			Variadic: m[3] != "" || m[5] != "",
+		})
+	}
+	return args
 }
 
 type Field struct {
@@ -30,6 +84,26 @@ type Field struct {
 	Description string
 	Type        FieldType
 	Array       bool
+	// Options are the allowed values of Enum fields.
+	Options []string
+	// Suggestions returns values offered while typing in Text fields, which
+	// aren't enforced. It is called each time the form is shown.
+	Suggestions func() []string
+	// Extensions filter the files shown in the browser of File fields,
+	// e.g. ".csv". All files are shown if empty.
+	Extensions []string
+	// Secret fields are shown as password inputs, redacted in the runs and
+	// the audit log, and never written to the config files.
+	Secret bool
+	// Required fields must have a value to launch the command.
+	Required bool
+	// Min and Max bound the values of Number fields.
+	Min *float64
+	Max *float64
+	// Pattern is a regular expression that values must match entirely.
+	Pattern string
+	// Validate is called with each value before launching the command.
+	Validate func(string) error
 }
 
 type FieldType int
@@ -38,14 +112,168 @@ const (
 	Text FieldType = iota
 	Number
 	Boolean
+	Enum
+	Duration
+	Time
+	Date
+	Size
+	// Map fields hold key/value pairs, entered and passed as "key=value".
+	// Pairs are passed as repeated flags if the field is an array, or joined
+	// with commas in a single flag otherwise.
+	Map
+	// File and Directory fields hold paths, which can be picked from the
+	// browse roots of the server (see WithBrowseRoots).
+	File
+	Directory
+	// Upload fields hold files uploaded from the browser, which are passed
+	// as the paths where they are stored during the run
+	// (see WithUploadRetention).
+	Upload
 )
 
+// String returns the name of the field type.
+func (t FieldType) String() string {
+	switch t {
+	case Number:
+		return "number"
+	case Boolean:
+		return "boolean"
+	case Enum:
+		return "enum"
+	case Duration:
+		return "duration"
+	case Time:
+		return "time"
+	case Date:
+		return "date"
+	case Size:
+		return "size"
+	case Map:
+		return "map"
+	case File:
+		return "file"
+	case Directory:
+		return "directory"
+	case Upload:
+		return "upload"
+	default:
+		return "text"
+	}
+}
+
+// sizeRegexp matches byte sizes such as "512", "1.5GB" or "10MiB".
+var sizeRegexp = regexp.MustCompile(`^(\d+(\.\d+)?)\s*([KMGTPkmgtp]i?[Bb]?|[Bb])?$`)
+
+// parse validates a value entered for the field and returns it in the format
+// passed to the command.
+// Empty durations, times, dates and sizes are allowed and mean the value is
+// unset.
+func (f *Field) parse(value string) (string, error) {
+	switch f.Type {
+	case Enum:
+		// Empty values are allowed when the field has no default
+		if value == "" && f.Default == "" {
+			return value, nil
+		}
+		for _, opt := range f.Options {
+			if value == opt {
+				return value, nil
+			}
+		}
+		return "", fmt.Errorf("invalid value %q for %s, must be one of: %s", value, f.Name, strings.Join(f.Options, ", "))
+	case Duration, Time, Date, Size:
+		value = strings.TrimSpace(value)
+		if value == "" {
+			return "", nil
+		}
+	case Map:
+		if strings.TrimSpace(value) == "" {
+			return "", nil
+		}
+		k, v, ok := strings.Cut(value, "=")
+		k = strings.TrimSpace(k)
+		if !ok || k == "" {
+			return "", fmt.Errorf("invalid pair %q for %s, must be key=value", value, f.Name)
+		}
+		return k + "=" + v, nil
+	default:
+		return value, nil
+	}
+
+	switch f.Type {
+	case Duration:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return "", fmt.Errorf("invalid duration %q for %s", value, f.Name)
+		}
+		return d.String(), nil
+	case Time:
+		// Inputs of type datetime-local don't include the time zone
+		for _, layout := range []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+			if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+				return t.Format(time.RFC3339), nil
+			}
+		}
+		return "", fmt.Errorf("invalid time %q for %s, must be RFC3339", value, f.Name)
+	case Date:
+		if _, err := time.Parse(time.DateOnly, value); err != nil {
+			return "", fmt.Errorf("invalid date %q for %s, must be YYYY-MM-DD", value, f.Name)
+		}
+		return value, nil
+	default:
+		m := sizeRegexp.FindStringSubmatch(value)
+		if m == nil {
+			return "", fmt.Errorf("invalid size %q for %s", value, f.Name)
+		}
+		// Normalize the unit, e.g. "10mib" to "10MiB"
+		unit := strings.TrimSuffix(strings.ToUpper(m[3]), "B")
+		switch {
+		case unit == "":
+		case strings.HasSuffix(unit, "I"):
+			unit = unit[:1] + "iB"
+		default:
+			unit += "B"
+		}
+		return m[1] + unit, nil
+	}
+}
+
+// splitArray returns the values of an array such as "[a,b]", which are
+// parsed as CSV so values can contain quoted commas, e.g. `["a,b",c]`.
+func splitArray(value string) []string {
+	value = strings.TrimSpace(value)
+	value = strings.TrimSuffix(strings.TrimPrefix(value, "["), "]")
+	if value == "" {
+		return nil
+	}
+	values, err := csv.NewReader(strings.NewReader(value)).Read()
+	if err != nil {
+		return strings.Split(value, ",")
+	}
+	return values
+}
+
+// joinArray is the inverse of splitArray.
+func joinArray(values []string) string {
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	_ = w.Write(values)
+	w.Flush()
+	return "[" + strings.TrimSuffix(buf.String(), "\n") + "]"
+}
+
 type parsedCommand struct {
 	Fields      []*Field
 	Name        string
 	Description string
+	Args        []*Arg
+	GracePeriod time.Duration
 }
 
+// argPrefix is the prefix of the form inputs of positional arguments, to
+// avoid collisions with the flags.
+const argPrefix = "arg:"
+
 type Option func(*options) error
 
 // WithAppName sets the application name.
@@ -128,6 +356,217 @@ func WithDisableConfig() Option {
 	}
 }
 
+// WithExecutor sets the executor used to launch the commands.
+// By default, commands are launched by running another instance of the
+// current executable (see NewSelfExecutor).
+func WithExecutor(e Executor) Option {
+	return func(o *options) error {
+		if e == nil {
+			return fmt.Errorf("webcli: executor can't be nil")
+		}
+		o.executor = e
+		return nil
+	}
+}
+
+// WithRunStore sets the store used to keep the history of launched commands.
+// By default, runs are stored in the "runs" folder, one folder per run.
+func WithRunStore(s RunStore) Option {
+	return func(o *options) error {
+		if s == nil {
+			return fmt.Errorf("webcli: run store can't be nil")
+		}
+		o.runStore = s
+		return nil
+	}
+}
+
+// WithLogBufferSize sets the maximum number of bytes of output kept in memory
+// for each process and shown when the logs page is opened.
+// Earlier output can be loaded from the run store on demand.
+// By default, the last 1 MB of output is kept.
+func WithLogBufferSize(size int) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return fmt.Errorf("webcli: log buffer size must be positive")
+		}
+		o.logBufferSize = size
+		return nil
+	}
+}
+
+// WithAuthenticator requires the requests to be authenticated by one of the
+// given authenticators (see NewBasicAuthenticator, NewTokenAuthenticator and
+// NewProxyAuthenticator).
+// It can be used multiple times to accept different kinds of credentials.
+// Browser users without credentials are sent to a login page.
+func WithAuthenticator(authenticators ...Authenticator) Option {
+	return func(o *options) error {
+		for _, a := range authenticators {
+			if a == nil {
+				return fmt.Errorf("webcli: authenticator can't be nil")
+			}
+		}
+		o.authenticators = append(o.authenticators, authenticators...)
+		return nil
+	}
+}
+
+// WithPolicy restricts the actions that each user can perform on each
+// command (see Policy and LoadPolicy).
+// Users are identified by the authenticators set with WithAuthenticator.
+func WithPolicy(p *Policy) Option {
+	return func(o *options) error {
+		if p == nil {
+			return fmt.Errorf("webcli: policy can't be nil")
+		}
+		if err := p.validate(); err != nil {
+			return err
+		}
+		o.policy = p
+		return nil
+	}
+}
+
+// WithAuditSink records who launched, canceled and saved the config of each
+// command in the given audit sink (see NewFileAuditSink and
+// NewMemoryAuditSink).
+// The audit log can be browsed from the "Audit" page.
+func WithAuditSink(s AuditSink) Option {
+	return func(o *options) error {
+		if s == nil {
+			return fmt.Errorf("webcli: audit sink can't be nil")
+		}
+		o.auditSink = s
+		return nil
+	}
+}
+
+// WithSecretPattern marks as secret the fields whose name matches the regular
+// expression, e.g. "(?i)(password|token|secret)".
+func WithSecretPattern(pattern string) Option {
+	return func(o *options) error {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("webcli: invalid secret pattern: %w", err)
+		}
+		o.secretPattern = re
+		return nil
+	}
+}
+
+// WithSecretStore saves the values of secret fields in the given store when
+// the config is saved. Without a secret store, secret values aren't saved.
+func WithSecretStore(s SecretStore) Option {
+	return func(o *options) error {
+		if s == nil {
+			return fmt.Errorf("webcli: secret store can't be nil")
+		}
+		o.secretStore = s
+		return nil
+	}
+}
+
+// WithBrowseRoots allows browsing the files and directories under the given
+// root directories to fill File and Directory fields.
+// Paths outside the roots, including the targets of symlinks, can't be
+// browsed.
+func WithBrowseRoots(roots ...string) Option {
+	return func(o *options) error {
+		for _, root := range roots {
+			abs, err := filepath.Abs(root)
+			if err != nil {
+				return fmt.Errorf("webcli: invalid browse root %s: %w", root, err)
+			}
+			resolved, err := filepath.EvalSymlinks(abs)
+			if err != nil {
+				return fmt.Errorf("webcli: invalid browse root %s: %w", root, err)
+			}
+			info, err := os.Stat(resolved)
+			if err != nil {
+				return fmt.Errorf("webcli: invalid browse root %s: %w", root, err)
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("webcli: browse root %s isn't a directory", root)
+			}
+			o.browseRoots = append(o.browseRoots, resolved)
+		}
+		return nil
+	}
+}
+
+// WithUploadRetention sets how long the files uploaded for a run are kept
+// after the run ends. By default, they are removed as soon as it ends.
+// Negative values keep the files.
+func WithUploadRetention(d time.Duration) Option {
+	return func(o *options) error {
+		o.uploadRetention = d
+		return nil
+	}
+}
+
+// WithMaxUploadSize sets the maximum number of bytes of the forms submitted
+// to launch a command, including the uploaded files. Larger forms are
+// rejected. By default, forms can be up to 100 MB.
+func WithMaxUploadSize(size int64) Option {
+	return func(o *options) error {
+		if size <= 0 {
+			return fmt.Errorf("webcli: max upload size must be positive")
+		}
+		o.maxUploadSize = size
+		return nil
+	}
+}
+
+// WithGracePeriod sets how long commands are given to exit after being
+// canceled, once they receive the stop signal, before they are killed.
+// It can be overridden per command with Command.GracePeriod.
+// By default, commands are given 10 seconds.
+func WithGracePeriod(d time.Duration) Option {
+	return func(o *options) error {
+		o.gracePeriod = d
+		return nil
+	}
+}
+
+// WithStopSignal sets the signal sent to the process group of the commands
+// when they are canceled, usually os.Interrupt or syscall.SIGTERM.
+// By default, SIGTERM is sent.
+func WithStopSignal(sig os.Signal) Option {
+	return func(o *options) error {
+		if sig == nil {
+			return fmt.Errorf("webcli: stop signal can't be nil")
+		}
+		o.stopSignal = sig
+		return nil
+	}
+}
+
+// LaunchMode defines which flags are passed to the launched commands.
+type LaunchMode int
+
+const (
+	// LaunchAllFlags passes all the flags with values, including the ones
+	// equal to their defaults.
+	LaunchAllFlags LaunchMode = iota
+	// LaunchChangedFlags only passes the flags whose values differ from their
+	// defaults, so the command applies its own defaults.
+	LaunchChangedFlags
+)
+
+// WithLaunchMode sets which flags are passed to the launched commands.
+// The default mode is LaunchAllFlags.
+// In both modes, runs record the effective arguments including the defaults.
+func WithLaunchMode(m LaunchMode) Option {
+	return func(o *options) error {
+		if m != LaunchAllFlags && m != LaunchChangedFlags {
+			return fmt.Errorf("webcli: invalid launch mode %d", m)
+		}
+		o.launchMode = m
+		return nil
+	}
+}
+
 // WithDebug enables debug mode.
 func WithDebug() Option {
 	return func(o *options) error {
@@ -145,6 +584,23 @@ type options struct {
 	readConfig    func(path string) (map[string]any, error)
 	writeConfig   func(path string, values map[string]any) error
 
+	executor      Executor
+	runStore      RunStore
+	logBufferSize int
+	gracePeriod   time.Duration
+	stopSignal    os.Signal
+
+	authenticators []Authenticator
+	policy         *Policy
+	auditSink      AuditSink
+	secretPattern  *regexp.Regexp
+	secretStore    SecretStore
+	launchMode     LaunchMode
+	browseRoots    []string
+
+	uploadRetention time.Duration
+	maxUploadSize   int64
+
 	debug bool
 }
 
@@ -173,6 +629,12 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 		writeConfig: func(path string, values map[string]any) error {
 			return config.Write(path, values)
 		},
+		executor:      NewSelfExecutor(),
+		runStore:      NewDirRunStore("runs"),
+		logBufferSize: defaultLogBufferSize,
+		maxUploadSize: defaultMaxUploadSize,
+		gracePeriod:   defaultGracePeriod,
+		stopSignal:    syscall.SIGTERM,
 	}
 
 	// Override options
@@ -182,11 +644,31 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 		}
 	}
 
+	// Runs that didn't end were interrupted by a previous shutdown
+	runs, err := o.runStore.List()
+	if err != nil {
+		return nil, err
+	}
+	for _, run := range runs {
+		if !run.End.IsZero() || run.Interrupted {
+			continue
+		}
+		run.Interrupted = true
+		if err := o.runStore.Update(run); err != nil {
+			return nil, err
+		}
+	}
+
 	// Create a context for handling the server
 	ctx, cancel := context.WithCancel(context.Background())
 
 	// Convert command tree to a flat list
 	parsedCmds := parseCommands(commands, "")
+	o.markSecrets(parsedCmds)
+	if err := checkPatterns(parsedCmds); err != nil {
+		cancel()
+		return nil, err
+	}
 
 	// Create lookup and name list
 	var cmdLookup = map[string]*parsedCommand{}
@@ -207,6 +689,10 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 		w.Header().Set("HX-Push-Url", "/")
 		var cmds []view.CommandEntry
 		for _, name := range cmdNames {
+			// Hide the commands the user can't access
+			if !o.allowed(r, name, ActionView) {
+				continue
+			}
 			cmds = append(cmds, view.CommandEntry{
 				Name:        name,
 				Description: cmdLookup[name].Description,
@@ -222,6 +708,10 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 	for name, cmd := range cmdLookup {
 		path := fmt.Sprintf("/commands/%s", name)
 		mux.Handle(path, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !o.allowed(r, name, ActionView) {
+				httpError(w, "forbidden", http.StatusForbidden)
+				return
+			}
 			w.Header().Set("HX-Push-Url", path)
 
 			// Check if the form should use default values
@@ -235,48 +725,74 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 					log.Println("webcli:", err)
 				} else {
 					for k, v := range candidate {
-						configValues[k] = fmt.Sprintf("%v", v)
+						configValues[k] = configValue(v)
 					}
 				}
 			}
 
-			// Create form fields
-			var fields []view.Field
+			// Render the form
+			o.renderForm(w, r, cmd, configValues, nil, nil)
+		}))
+	}
+
+	// File browser handler
+	if len(o.browseRoots) > 0 {
+		mux.Handle("/browse", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			q := r.URL.Query()
+			cmdName := q.Get("command")
+			// Permissions are checked first so unknown commands can't be told
+			// apart from forbidden ones
+			if !o.allowed(r, cmdName, ActionView) {
+				httpError(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			cmd, ok := cmdLookup[cmdName]
+			if !ok {
+				httpError(w, "command not found", http.StatusNotFound)
+				return
+			}
+			var field *Field
 			for _, f := range cmd.Fields {
-				t := view.Text
-				switch f.Type {
-				case Number:
-					t = view.Number
-				case Boolean:
-					t = view.Boolean
+				if f.Name == q.Get("field") && (f.Type == File || f.Type == Directory) {
+					field = f
 				}
-				def := f.Default
+			}
+			if field == nil {
+				httpError(w, "field not found", http.StatusNotFound)
+				return
+			}
 
-				// Check if the value is in the config file
-				if v, ok := configValues[f.Name]; ok {
-					def = v
+			// Start from the current value of the field, if it can be browsed
+			path := q.Get("path")
+			if path == "" {
+				if vs := q[field.Name]; len(vs) > 0 && vs[len(vs)-1] != "" {
+					if _, _, err := o.allowedPath(vs[len(vs)-1]); err == nil {
+						path = vs[len(vs)-1]
+					}
 				}
+			}
 
-				vf := view.Field{
-					Name:        f.Name,
-					Default:     def,
-					Description: f.Description,
-					Type:        t,
-					Array:       f.Array,
+			b, err := o.browse(cmd, field, path)
+			if err != nil {
+				// Errors are shown inside the browser, along with the roots
+				log.Println(err)
+				b, _ = o.browse(cmd, field, "")
+				b.Error = "Couldn't open " + path
+				if errors.Is(err, errPathNotAllowed) {
+					b.Error = path + " is outside the allowed folders"
 				}
-				fields = append(fields, vf)
 			}
-
-			// Render the form
-			v := view.Form(o.app, name, fields, !o.disableConfig)
+			v := view.Browse(b)
 			if err := v.Render(r.Context(), w); err != nil {
 				log.Println("webcli: couldn't render view:", err)
 			}
 		}))
 	}
 
-	var lck sync.Mutex
-	processes := map[string]*process{}
+	runner := newRunner(ctx, o, cmdLookup)
+
+	// JSON API handler
+	mux.Handle("/api/v1/", apiHandler(o, parsedCmds, runner))
 
 	// Event stream handler
 	mux.Handle("/events/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -286,13 +802,24 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 			httpError(w, "id is empty", http.StatusBadRequest)
 			return
 		}
-		lck.Lock()
-		proc, ok := processes[id]
-		lck.Unlock()
+		proc, ok := runner.process(id)
 
-		// If the process doesn't exist, return a close event
+		// If the process isn't running, return a close event with the final
+		// status of the run if it exists
 		if !ok {
-			fmt.Fprint(w, "event: close\ndata: <div></div>\n\n")
+			status := "<div></div>"
+			if run, err := o.runStore.Get(id); err == nil && o.allowed(r, run.Command, ActionView) {
+				var buf bytes.Buffer
+				if err := view.Status(runEntry(run)).Render(r.Context(), &buf); err != nil {
+					log.Println("webcli: couldn't render view:", err)
+				}
+				status = strings.ReplaceAll(buf.String(), "\n", "")
+			}
+			fmt.Fprintf(w, "event: close\ndata: %s\n\n", status)
+			return
+		}
+		if !o.allowed(r, proc.Run().Command, ActionView) {
+			httpError(w, "forbidden", http.StatusForbidden)
 			return
 		}
 
@@ -301,93 +828,348 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 		w.Header().Set("Cache-Control", "no-cache")
 		w.Header().Set("Connection", "keep-alive")
 
-		// Create a channel to send data
-		dataC := make(chan string)
-		defer close(dataC)
-
-		// Create a context for handling client disconnection
-		_, cancel := context.WithCancel(r.Context())
-		defer cancel()
+		// Queue the events to send. The callback is called while the process
+		// publishes its output, so it never waits for the client: events are
+		// queued and the stream is ended if the client falls behind by more
+		// than the output kept in memory, so the browser reconnects
+		var (
+			queueLck sync.Mutex
+			queue    []string
+			queued   int
+			lagging  bool
+		)
+		wake := make(chan struct{}, 1)
+		send := func(text string) {
+			queueLck.Lock()
+			if queued += len(text); queued > o.logBufferSize {
+				lagging, queue = true, nil
+			}
+			if !lagging {
+				queue = append(queue, text)
+			}
+			queueLck.Unlock()
+			select {
+			case wake <- struct{}{}:
+			default:
+			}
+		}
 
 		// Generate a random ID
 		subID := fmt.Sprintf("%d", time.Now().UnixNano())
 
 		// Subscribe to the process logs
 		proc.Subscribe(subID, func(text string, close bool) {
-			text = strings.ReplaceAll(text, "\n", "<br>")
-			text = fmt.Sprintf("event: log\ndata: %s\n\n", text)
-			dataC <- text
+			if text != "" {
+				// Each line of output is a separate event, already escaped HTML
+				// without new lines
+				send(fmt.Sprintf("event: log\ndata: %s\n\n", text))
+			}
 			if close {
-				text = "event: close\ndata: <div></div>\n\n"
-				dataC <- text
-				cancel()
+				// Replace the event stream with the final status
+				var buf bytes.Buffer
+				if err := view.Status(proc.Entry()).Render(context.Background(), &buf); err != nil {
+					log.Println("webcli: couldn't render view:", err)
+				}
+				status := strings.ReplaceAll(buf.String(), "\n", "")
+				send(fmt.Sprintf("event: close\ndata: %s\n\n", status))
+				// An empty event ends the stream
+				send("")
 			}
 		})
 		defer proc.Unsubscribe(subID)
 
-		// Send event data to the client
+		// Send event data to the client until the process ends
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case <-r.Context().Done():
 				return
-			case data := <-dataC:
+			case <-wake:
+			}
+			queueLck.Lock()
+			pending, ended := queue, lagging
+			queue, queued = nil, 0
+			queueLck.Unlock()
+			if ended {
+				return
+			}
+			for _, data := range pending {
+				if data == "" {
+					return
+				}
 				fmt.Fprint(w, data)
-				w.(http.Flusher).Flush()
 			}
+			w.(http.Flusher).Flush()
 		}
 	}))
 
 	// Log list page handler
 	mux.Handle("/logs", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("HX-Push-Url", "/logs")
+		runs, err := runner.list()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
 		var logs []view.LogEntry
-		for id, p := range processes {
-			logs = append(logs, view.LogEntry{
-				ID:       id,
-				Command:  p.command,
-				Start:    p.start,
-				End:      p.end,
-				Error:    p.error,
-				Canceled: p.canceled,
-			})
+		for _, run := range runs {
+			if !o.allowed(r, run.Command, ActionView) {
+				continue
+			}
+			logs = append(logs, runEntry(run))
 		}
-		// Order from newest to oldest
-		sort.Slice(logs, func(i, j int) bool {
-			return logs[i].Start.After(logs[j].Start)
-		})
 		v := view.ListLog(o.app, logs)
 		if err := v.Render(r.Context(), w); err != nil {
 			log.Println("webcli: couldn't render view:", err)
 		}
 	}))
 
-	// Log page handler
-	logHandler := func(w http.ResponseWriter, r *http.Request, cancel bool) {
+	// Log page handler, which also stops the process if stop is set
+	logHandler := func(w http.ResponseWriter, r *http.Request, stop func(*process)) {
+		// Processes are only stopped on post, so other sites can't stop them
+		// by linking to the page
+		if stop != nil && r.Method != http.MethodPost {
+			httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
 		// Get process ID
 		id := r.PathValue("id")
-		proc, ok := processes[id]
-		if !ok {
-			httpError(w, "reader not found", http.StatusNotFound)
+		run, err := runner.get(id)
+		if errors.Is(err, ErrRunNotFound) {
+			httpError(w, "run not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		if cancel {
-			proc.cancel()
+		action := ActionView
+		if stop != nil {
+			action = ActionCancel
+		}
+		if !o.allowed(r, run.Command, action) {
+			httpError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		if stop != nil && !run.End.IsZero() {
+			httpError(w, "run is not in progress", http.StatusConflict)
+			return
+		}
+
+		proc, ok := runner.process(id)
+		var entry view.LogEntry
+		var logs string
+		var offset int64
+		switch {
+		case ok:
+			if stop != nil {
+				stop(proc)
+				o.audit(r, &AuditEvent{
+					Action:  ActionCancel,
+					Command: run.Command,
+					RunID:   id,
+				})
+			}
+			entry = proc.Entry()
+			logs, offset = proc.Logs()
+		case stop != nil:
+			httpError(w, "process not found", http.StatusNotFound)
+			return
+		default:
+			// Load the output from the store
+			output, err := o.runStore.Output(id)
+			if err != nil {
+				httpError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			// Only the tail of the output is shown
+			data, start, err := readBefore(output, -1, o.logBufferSize)
+			_ = output.Close()
+			if err != nil {
+				httpError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			entry = runEntry(run)
+			logs, offset = formatLogs(data, run.Start), start
 		}
 		w.Header().Set("HX-Push-Url", fmt.Sprintf("/logs/%s", id))
-		v := view.Log(o.app, id, proc.Logs())
+		v := view.Log(o.app, entry, logs, offset)
 		if err := v.Render(r.Context(), w); err != nil {
 			log.Println("webcli: couldn't render view:", err)
 		}
 	}
 	mux.Handle("/logs/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logHandler(w, r, false)
+		logHandler(w, r, nil)
+	}))
+
+	// Earlier output handler
+	mux.Handle("/logs/{id}/output", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		before, err := strconv.ParseInt(r.URL.Query().Get("before"), 10, 64)
+		if err != nil || before < 0 {
+			httpError(w, "invalid before parameter", http.StatusBadRequest)
+			return
+		}
+
+		run, err := runner.get(id)
+		if errors.Is(err, ErrRunNotFound) {
+			httpError(w, "run not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !o.allowed(r, run.Command, ActionView) {
+			httpError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		// The full output is always available in the store
+		output, err := o.runStore.Output(id)
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		data, start, err := readBefore(output, before, logPageSize)
+		_ = output.Close()
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		v := view.EarlierLogs(id, formatLogs(data, run.Start), start)
+		if err := v.Render(r.Context(), w); err != nil {
+			log.Println("webcli: couldn't render view:", err)
+		}
+	}))
+
+	// Output download handler
+	mux.Handle("/logs/{id}/download", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		stream := r.URL.Query().Get("stream")
+		if !validStream(stream) {
+			httpError(w, "invalid stream", http.StatusBadRequest)
+			return
+		}
+		run, err := runner.get(id)
+		if errors.Is(err, ErrRunNotFound) {
+			httpError(w, "run not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !o.allowed(r, run.Command, ActionView) {
+			httpError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		name := id
+		if stream != "" {
+			name += "-" + stream
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name+".log"))
+		// The last record of a running process may be still being written
+		ended := !run.End.IsZero() || run.Interrupted
+		if _, err := copyOutput(w, o.runStore, id, 0, stream, ended); err != nil {
+			log.Println("webcli:", err)
+		}
+	}))
+
+	// Standard input handler
+	mux.Handle("/input/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only post method is allowed
+		if r.Method != http.MethodPost {
+			httpError(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		proc, ok := runner.process(r.PathValue("id"))
+		if !ok {
+			httpError(w, "process not found", http.StatusNotFound)
+			return
+		}
+		if !o.allowed(r, proc.Run().Command, ActionRun) {
+			httpError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var errMsg string
+		if err := proc.Input(r.FormValue("line"), r.FormValue("eof") != ""); err != nil {
+			log.Println(err)
+			errMsg = "Couldn't send the input, the process may have ended"
+		}
+		v := view.Input(proc.Entry(), errMsg)
+		if err := v.Render(r.Context(), w); err != nil {
+			log.Println("webcli: couldn't render view:", err)
+		}
+	}))
+
+	// Terminal websocket handler
+	mux.Handle("/terminal/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		run, err := runner.get(id)
+		if errors.Is(err, ErrRunNotFound) {
+			httpError(w, "run not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			httpError(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !o.allowed(r, run.Command, ActionView) {
+			httpError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		// Only users allowed to run the command can type in the terminal
+		input := o.allowed(r, run.Command, ActionRun)
+
+		// The upgrader replies with an error itself
+		conn, err := terminalUpgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Println("webcli: couldn't upgrade terminal connection:", err)
+			return
+		}
+		defer closeWebSocket(conn)
+
+		proc, ok := runner.process(id)
+		if ok {
+			serveTerminal(conn, proc, input, o.logBufferSize)
+			return
+		}
+
+		// Finished runs only show the tail of the stored output
+		output, err := o.runStore.Output(id)
+		if err != nil {
+			log.Println("webcli: couldn't load output:", err)
+			return
+		}
+		data, _, err := readBefore(output, -1, o.logBufferSize)
+		_ = output.Close()
+		if err != nil {
+			log.Println("webcli: couldn't read output:", err)
+			return
+		}
+		if err := conn.WriteMessage(websocket.BinaryMessage, outputText(data, "")); err != nil {
+			log.Println("webcli: couldn't send output:", err)
+		}
 	}))
 
 	// Cancel command handler
 	mux.Handle("/cancel/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		logHandler(w, r, true)
+		logHandler(w, r, (*process).Stop)
+	}))
+
+	// Force kill command handler
+	mux.Handle("/kill/{id}", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logHandler(w, r, (*process).Kill)
 	}))
 
 	// Command save handler
@@ -419,6 +1201,10 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 				httpError(w, "command not found", http.StatusNotFound)
 				return
 			}
+			if !o.allowed(r, cmdName, ActionSave) {
+				httpError(w, "forbidden", http.StatusForbidden)
+				return
+			}
 
 			// Get fields from the form
 			var fields = map[string][]string{}
@@ -440,24 +1226,46 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 			// Convert values to a map of single values if not an array
 			var values = map[string]any{}
 			for _, f := range cmd.Fields {
+				// Uploads are only kept during the run
+				if f.Type == Upload {
+					continue
+				}
 				if vs, ok := fields[f.Name]; ok {
+					for i, v := range vs {
+						parsed, err := f.parse(v)
+						if err != nil {
+							httpError(w, err.Error(), http.StatusBadRequest)
+							return
+						}
+						vs[i] = parsed
+					}
 					switch {
+					case f.Type == Map:
+						pairs := map[string]string{}
+						for _, v := range vs {
+							if k, v, ok := strings.Cut(v, "="); ok {
+								pairs[k] = v
+							}
+						}
+						values[f.Name] = pairs
 					case f.Array:
-						if len(vs) == 1 && vs[0] == "" {
-							values[f.Name] = []string{}
-						} else {
-							values[f.Name] = vs
+						list := []any{}
+						for _, v := range vs {
+							if v == "" && f.Type != Text {
+								continue
+							}
+							list = append(list, configScalar(f.Type, v))
+						}
+						if len(list) == 1 && list[0] == "" {
+							list = []any{}
 						}
+						values[f.Name] = list
+					case vs[0] == "" && f.Type != Text:
+						// Unset values aren't saved
 					case f.Type == Boolean:
 						values[f.Name] = vs[0] == "on"
 					case f.Type == Number:
-						if num, err := strconv.Atoi(vs[0]); err == nil {
-							values[f.Name] = num
-						} else if num, err := strconv.ParseFloat(vs[0], 64); err == nil {
-							values[f.Name] = num
-						} else {
-							values[f.Name] = 0
-						}
+						values[f.Name] = configScalar(f.Type, vs[0])
 					default:
 						values[f.Name] = vs[0]
 					}
@@ -465,7 +1273,7 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 			}
 
 			// Write values to the config file
-			if err := o.writeConfig(o.configPath(cmdName), values); err != nil {
+			if err := o.saveConfig(r, cmd, values); err != nil {
 				log.Println("webcli:", err)
 				v := view.SaveError()
 				if err := v.Render(r.Context(), w); err != nil {
@@ -490,11 +1298,26 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 			return
 		}
 
-		// Parse form
-		if err := r.ParseForm(); err != nil {
+		// Parse form, which is multipart if it contains uploads
+		r.Body = http.MaxBytesReader(w, r.Body, o.maxUploadSize)
+		var err error
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+			err = r.ParseMultipartForm(uploadMemory)
+		} else {
+			err = r.ParseForm()
+		}
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			httpError(w, fmt.Sprintf("form is larger than %d bytes", maxErr.Limit), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if r.MultipartForm != nil {
+			defer func() { _ = r.MultipartForm.RemoveAll() }()
+		}
 
 		// Execute command
 		cmdName := r.FormValue("command")
@@ -502,43 +1325,182 @@ func New(commands []*Command, opts ...Option) (*Server, error) {
 			httpError(w, "command field is empty", http.StatusBadRequest)
 			return
 		}
-		args := []string{cmdName}
+		cmd, ok := cmdLookup[cmdName]
+		if !ok {
+			httpError(w, "command not found", http.StatusNotFound)
+			return
+		}
+		if !o.allowed(r, cmdName, ActionRun) {
+			httpError(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		// Validate the values before launching the command
+		submitted := map[string][]string{}
 		for k, vs := range r.Form {
-			if k == "command" {
-				continue
+			submitted[k] = vs
+		}
+		changedOnly := o.launchMode == LaunchChangedFlags
+		if changedOnly {
+			// Unchecked booleans aren't submitted, but they may turn off a
+			// flag that is enabled by default
+			for _, f := range cmd.Fields {
+				if f.Type == Boolean && len(submitted[f.Name]) == 0 {
+					submitted[f.Name] = []string{"false"}
+				}
+			}
+		}
+		// Uploaded files are passed as the paths where they are staged
+		uploads, err := o.stageUploads(r, cmd, submitted)
+		if err != nil {
+			log.Println(err)
+			httpError(w, "couldn't store uploads", http.StatusInternalServerError)
+			return
+		}
+		flags, effective, flagErr := cmd.flagArgs(submitted, func(field string) string {
+			return o.secret(cmdName, field)
+		}, changedOnly)
+		// Positional arguments go after the flags
+		argValues := map[string][]string{}
+		for _, a := range cmd.Args {
+			argValues[a.Name] = r.Form[argPrefix+a.Name]
+		}
+		positional, argErr := cmd.positionalArgs(argValues)
+		if flagErr != nil || argErr != nil {
+			// Show the form again with the errors of each field
+			errs := fieldErrors{}
+			if fe, ok := flagErr.(fieldErrors); ok {
+				for k, v := range fe {
+					errs[k] = v
+				}
+			}
+			if fe, ok := argErr.(fieldErrors); ok {
+				for k, v := range fe {
+					errs[argPrefix+k] = v
+				}
 			}
-			for _, value := range vs {
-				// Convert checkbox on/off to true/false
-				switch value {
-				case "on":
-					value = "true"
-				case "off":
-					value = "false"
+			values := map[string]string{}
+			for _, f := range cmd.Fields {
+				vs := r.Form[f.Name]
+				switch {
+				case f.Type == Boolean:
+					values[f.Name] = strconv.FormatBool(len(vs) > 0)
+				case f.Array || f.Type == Map:
+					values[f.Name] = joinArray(vs)
+				case len(vs) > 0:
+					values[f.Name] = vs[0]
 				}
-				args = append(args, fmt.Sprintf("--%s=%s", k, value))
 			}
+			_ = os.RemoveAll(uploads)
+			w.Header().Set("HX-Push-Url", fmt.Sprintf("/commands/%s", cmdName))
+			o.renderForm(w, r, cmd, values, argValues, errs)
+			return
 		}
-		id := strings.Replace(time.Now().Format("20060102-150405.999"), ".", "-", 1)
-		proc, err := newProcess(ctx, args, o.debug)
+		args := append([]string{cmdName}, flags...)
+		args = append(args, positional...)
+		effective = append([]string{cmdName}, effective...)
+		effective = append(effective, positional...)
+
+		id, proc, err := runner.start(args, effective)
 		if err != nil {
+			_ = os.RemoveAll(uploads)
 			httpError(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
-		lck.Lock()
-		processes[id] = proc
-		lck.Unlock()
+		if uploads != "" {
+			go func() {
+				<-proc.Done()
+				o.removeUploads(uploads)
+			}()
+		}
+		o.audit(r, &AuditEvent{
+			Action:  ActionRun,
+			Command: cmdName,
+			Args:    proc.Run().Args,
+			RunID:   id,
+		})
 
 		// Replace URL
 		w.Header().Set("HX-Push-Url", fmt.Sprintf("/logs/%s", id))
 		// Log page
-		v := view.Log(o.app, id, proc.logs)
+		logs, offset := proc.Logs()
+		v := view.Log(o.app, proc.Entry(), logs, offset)
 		if err := v.Render(r.Context(), w); err != nil {
 			log.Println("webcli: couldn't render view:", err)
 		}
 	}))
 
+	// Audit log page handler
+	if o.auditSink != nil {
+		mux.Handle("/audit", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("HX-Push-Url", r.URL.RequestURI())
+			q := r.URL.Query()
+			filter := view.AuditFilter{
+				User:    q.Get("user"),
+				Command: q.Get("command"),
+				From:    q.Get("from"),
+				To:      q.Get("to"),
+			}
+			from, err := parseFilterTime(filter.From)
+			if err != nil {
+				httpError(w, "invalid from parameter", http.StatusBadRequest)
+				return
+			}
+			to, err := parseFilterEnd(filter.To)
+			if err != nil {
+				httpError(w, "invalid to parameter", http.StatusBadRequest)
+				return
+			}
+			events, err := o.auditSink.Query(AuditFilter{
+				User:    filter.User,
+				Command: filter.Command,
+				From:    from,
+				To:      to,
+			})
+			if err != nil {
+				httpError(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			var entries []view.AuditEntry
+			for _, e := range events {
+				// Only show the events of the commands the user can access
+				if !o.allowed(r, e.Command, ActionView) {
+					continue
+				}
+				entries = append(entries, auditEntry(e))
+			}
+			var names []string
+			for _, name := range cmdNames {
+				if o.allowed(r, name, ActionView) {
+					names = append(names, name)
+				}
+			}
+			v := view.Audit(o.app, filter, names, entries)
+			if err := v.Render(r.Context(), w); err != nil {
+				log.Println("webcli: couldn't render view:", err)
+			}
+		}))
+	}
+
+	// Require authentication
+	var handler http.Handler = mux
+	if o.auditSink != nil {
+		// Show the audit link in the navigation bar
+		next := handler
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r.WithContext(view.WithAudit(r.Context())))
+		})
+	}
+	if len(o.authenticators) > 0 {
+		a, err := newAuth(o.app, o.authenticators)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		handler = a.handler(handler)
+	}
+
 	return &Server{
-		Handler:    mux,
+		Handler:    handler,
 		cancel:     cancel,
 		customAddr: o.address,
 	}, nil
@@ -628,8 +1590,10 @@ func parseCommand(cmd *Command, parent string) *parsedCommand {
 		Name:        name,
 		Description: cmd.Description,
 		Fields:      cmd.Fields,
+		Args:        cmd.Args,
+		GracePeriod: cmd.GracePeriod,
 	}
-	if len(cmd.Fields) == 0 {
+	if len(cmd.Fields) == 0 && len(cmd.Args) == 0 {
 		// If it doesn't have flags, it's just a holder of subcommands
 		if len(cmd.Subcommands) > 0 {
 			return nil
@@ -639,7 +1603,199 @@ func parseCommand(cmd *Command, parent string) *parsedCommand {
 	return parsed
 }
 
+// renderForm renders the form of a command. The values replace the defaults
+// of the fields and errs contains the validation errors of the fields and
+// positional arguments, if any.
+func (o *options) renderForm(w http.ResponseWriter, r *http.Request, cmd *parsedCommand, values map[string]string, argValues map[string][]string, errs fieldErrors) {
+	// Create form fields
+	var fields []view.Field
+	for _, f := range cmd.Fields {
+		t := view.Text
+		switch f.Type {
+		case Number:
+			t = view.Number
+		case Boolean:
+			t = view.Boolean
+		case Enum:
+			t = view.Enum
+		}
+		// Lists of durations, times, dates and sizes are entered as text
+		if !f.Array {
+			switch f.Type {
+			case Duration:
+				t = view.Duration
+			case Time:
+				t = view.Time
+			case Date:
+				t = view.Date
+			case Size:
+				t = view.Size
+			case File:
+				t = view.File
+			case Directory:
+				t = view.Directory
+			}
+		}
+		if f.Type == Upload {
+			t = view.Upload
+		}
+		// Paths are entered as text if they can't be browsed
+		if (f.Type == File || f.Type == Directory) && len(o.browseRoots) == 0 {
+			t = view.Text
+		}
+		if f.Type == Map {
+			t = view.Map
+		}
+		def := f.Default
+		if v, ok := values[f.Name]; ok {
+			def = v
+		}
+		// Sizes are split in amount and unit, which is easier once normalized
+		if t == view.Size {
+			if v, err := f.parse(def); err == nil {
+				def = v
+			}
+		}
+
+		// Secret values are never sent to the browser
+		var saved bool
+		if f.Secret {
+			saved = f.Default != "" || o.secret(cmd.Name, f.Name) != ""
+			def = ""
+		}
+
+		var list []string
+		if f.Array || f.Type == Map {
+			list = splitArray(def)
+		}
+		var suggestions []string
+		if f.Suggestions != nil && t == view.Text {
+			suggestions = f.Suggestions()
+		}
+
+		fields = append(fields, view.Field{
+			Name:        f.Name,
+			Default:     def,
+			Description: f.Description,
+			Type:        t,
+			Array:       f.Array,
+			Values:      list,
+			Options:     f.Options,
+			Suggestions: suggestions,
+			Secret:      f.Secret,
+			Saved:       saved,
+			Required:    f.Required,
+			Error:       errs[f.Name],
+		})
+	}
+
+	// Create positional argument inputs
+	var args []view.Arg
+	for _, a := range cmd.Args {
+		var suggestions []string
+		if a.Suggestions != nil && len(a.Options) == 0 {
+			suggestions = a.Suggestions()
+		}
+		args = append(args, view.Arg{
+			Name:        a.Name,
+			Description: a.Description,
+			Required:    a.Required,
+			Variadic:    a.Variadic,
+			Options:     a.Options,
+			Suggestions: suggestions,
+			Values:      argValues[a.Name],
+			Error:       errs[argPrefix+a.Name],
+		})
+	}
+
+	// Render the form
+	v := view.Form(o.app, cmd.Name, fields, args, !o.disableConfig)
+	if err := v.Render(r.Context(), w); err != nil {
+		log.Println("webcli: couldn't render view:", err)
+	}
+}
+
+// saveConfig writes the config of a command, recording the changes in the
+// audit log.
+// Secret values are removed from the config and saved in the secret store,
+// if any.
+func (o *options) saveConfig(r *http.Request, cmd *parsedCommand, values map[string]any) error {
+	path := o.configPath(cmd.Name)
+	var old map[string]any
+	if o.auditSink != nil {
+		// The previous config may not exist yet
+		old, _ = o.readConfig(path)
+	}
+	var secrets []ConfigChange
+	for _, f := range cmd.Fields {
+		if !f.Secret {
+			continue
+		}
+		v, ok := values[f.Name]
+		delete(values, f.Name)
+		delete(old, f.Name)
+		if s, _ := v.(string); !ok || s == "" || o.secretStore == nil {
+			continue
+		}
+		if err := o.secretStore.SetSecret(cmd.Name, f.Name, v.(string)); err != nil {
+			return fmt.Errorf("webcli: couldn't save secret: %w", err)
+		}
+		secrets = append(secrets, ConfigChange{Field: f.Name, New: redacted})
+	}
+	if err := o.writeConfig(path, values); err != nil {
+		return err
+	}
+	o.audit(r, &AuditEvent{
+		Action:  ActionSave,
+		Command: cmd.Name,
+		Changes: append(configChanges(old, values), secrets...),
+	})
+	return nil
+}
+
 func httpError(w http.ResponseWriter, msg string, code int) {
 	log.Println(msg)
 	http.Error(w, msg, code)
 }
+
+// configScalar converts a form value to the type written to the config file.
+func configScalar(t FieldType, v string) any {
+	switch t {
+	case Number:
+		if num, err := strconv.Atoi(v); err == nil {
+			return num
+		}
+		if num, err := strconv.ParseFloat(v, 64); err == nil {
+			return num
+		}
+		return 0
+	case Boolean:
+		b, _ := strconv.ParseBool(v)
+		return b
+	default:
+		return v
+	}
+}
+
+// configValue converts a value read from a config file to the value of a form
+// field. Lists are converted to arrays, e.g. "[a,b]", and objects to
+// key/value pairs, e.g. "[a=1,b=2]".
+func configValue(v any) string {
+	switch v := v.(type) {
+	case []any:
+		var items []string
+		for _, item := range v {
+			items = append(items, fmt.Sprintf("%v", item))
+		}
+		return joinArray(items)
+	case map[string]any:
+		var pairs []string
+		for k, v := range v {
+			pairs = append(pairs, fmt.Sprintf("%s=%v", k, v))
+		}
+		sort.Strings(pairs)
+		return joinArray(pairs)
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
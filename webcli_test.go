@@ -0,0 +1,118 @@
+package webcli
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestServer creates a server whose runs are stored in a temporary folder
+// and that doesn't read or write config files.
+func newTestServer(t *testing.T, commands []*Command, opts ...Option) (*Server, RunStore) {
+	t.Helper()
+	store := NewDirRunStore(t.TempDir())
+	opts = append([]Option{WithRunStore(store), WithDisableConfig()}, opts...)
+	s, err := New(commands, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Stop(context.Background()) })
+	return s, store
+}
+
+// serve sends a request to the server and returns the recorded response.
+func serve(s *Server, method, target string, form url.Values) *httptest.ResponseRecorder {
+	var req *http.Request
+	if form != nil {
+		req = httptest.NewRequest(method, target, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	} else {
+		req = httptest.NewRequest(method, target, nil)
+	}
+	rec := httptest.NewRecorder()
+	s.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// waitRun waits until the run with the given ID matches the condition.
+func waitRun(t *testing.T, store RunStore, id string, cond func(*Run) bool) *Run {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		run, err := store.Get(id)
+		if err == nil && cond(run) {
+			return run
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("run %s didn't reach the expected state: %v", id, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestStopMethod(t *testing.T) {
+	s, store := newTestServer(t, []*Command{{Name: "wait"}},
+		WithExecutor(NewCommandExecutor("sh", "-c", "sleep 10")))
+
+	rec := serve(s, http.MethodPost, "/run", url.Values{"command": {"wait"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /run = %d, want %d", rec.Code, http.StatusOK)
+	}
+	runs, err := store.List()
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("store.List() = %d runs, %v, want 1 run", len(runs), err)
+	}
+	id := runs[0].ID
+
+	// Stopping a run with a link or a prefetch must not stop it
+	for _, path := range []string{"/cancel/", "/kill/"} {
+		if rec := serve(s, http.MethodGet, path+id, nil); rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("GET %s = %d, want %d", path, rec.Code, http.StatusMethodNotAllowed)
+		}
+	}
+	if run, err := store.Get(id); err != nil || !run.End.IsZero() {
+		t.Fatalf("run ended after GET requests: %v", err)
+	}
+
+	if rec := serve(s, http.MethodPost, "/kill/"+id, nil); rec.Code != http.StatusOK {
+		t.Errorf("POST /kill/ = %d, want %d", rec.Code, http.StatusOK)
+	}
+	waitRun(t, store, id, func(run *Run) bool { return !run.End.IsZero() })
+
+	// Ended runs can't be stopped again
+	if rec := serve(s, http.MethodPost, "/cancel/"+id, nil); rec.Code != http.StatusConflict {
+		t.Errorf("POST /cancel/ after end = %d, want %d", rec.Code, http.StatusConflict)
+	}
+}
+
+func TestRunUploads(t *testing.T) {
+	cmds := []*Command{{Name: "load", Fields: []*Field{{Name: "csv", Type: Upload}}}}
+	s, store := newTestServer(t, cmds,
+		WithExecutor(NewCommandExecutor("true")), WithMaxUploadSize(1024))
+
+	// Values that aren't files aren't passed as uploads
+	rec := serve(s, http.MethodPost, "/run", url.Values{"command": {"load"}, "csv": {"/etc/passwd"}})
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /run = %d, want %d", rec.Code, http.StatusOK)
+	}
+	runs, err := store.List()
+	if err != nil || len(runs) != 1 {
+		t.Fatalf("store.List() = %d runs, %v, want 1 run", len(runs), err)
+	}
+	for _, arg := range runs[0].Args {
+		if strings.Contains(arg, "/etc/passwd") {
+			t.Errorf("run args = %q, want no path of the server", runs[0].Args)
+		}
+	}
+	waitRun(t, store, runs[0].ID, func(run *Run) bool { return !run.End.IsZero() })
+
+	// Forms larger than the limit are rejected
+	large := url.Values{"command": {"load"}, "data": {strings.Repeat("x", 2048)}}
+	if rec := serve(s, http.MethodPost, "/run", large); rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("POST /run with a large form = %d, want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}